@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// annotationPrefix starts the comments that tell govvv which value to set a
+// package-level variable to, e.g. "//govvv:commit" or
+// "//govvv:value "{{.GitSummary}}"".
+const annotationPrefix = "//govvv:"
+
+// valueSources are the names annotations use for the values govvv collects,
+// mapped to the names of the variables govvv sets by default.
+var valueSources = map[string]string{
+	"version":     "Version",
+	"commit":      "GitCommit",
+	"branch":      "GitBranch",
+	"state":       "GitState",
+	"summary":     "GitSummary",
+	"build-date":  varBuildDate,
+	"build-unix":  varBuildUnix,
+	"commit-date": varCommitDate,
+	"change-id":   "ChangeID",
+}
+
+// splitSource splits source, as in sourceValue, into its verb and argument.
+func splitSource(source string) (verb, arg string) {
+	verb = strings.TrimSpace(source)
+	if i := strings.IndexAny(verb, " \t"); i != -1 {
+		verb, arg = verb[:i], strings.TrimSpace(verb[i:])
+	}
+	return verb, arg
+}
+
+// sourceUses reports whether source, as in sourceValue, may refer to the
+// value of the variable name.
+func sourceUses(source, name string) bool {
+	verb, arg := splitSource(source)
+	if verb == "value" {
+		return strings.Contains(arg, name)
+	}
+	return valueSources[verb] == name
+}
+
+// bareValues returns values keyed by variable name instead of "pkg.Name".
+func bareValues(values map[string]string) map[string]string {
+	out := make(map[string]string)
+	for k, v := range values {
+		out[k[strings.LastIndex(k, ".")+1:]] = v
+	}
+	return out
+}
+
+// sourceValue returns the value source refers to: either the name of a value
+// (see valueSources) or "value" followed by a quoted template that is
+// executed with the values keyed by variable name. ok is false if the value
+// is not available, e.g. there is no version.
+func sourceValue(source string, values map[string]string) (value string, ok bool, err error) {
+	bare := bareValues(values)
+	verb, arg := splitSource(source)
+	if verb != "value" {
+		name, known := valueSources[verb]
+		if !known || arg != "" {
+			return "", false, fmt.Errorf("unknown value %q", source)
+		}
+		value, ok = bare[name]
+		return value, ok, nil
+	}
+
+	text, err := strconv.Unquote(arg)
+	if err != nil {
+		return "", false, fmt.Errorf("value takes a quoted template, got %q", arg)
+	}
+	tmpl, err := template.New("value").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", false, err
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, bare); err != nil {
+		return "", false, err
+	}
+	return b.String(), true, nil
+}
+
+// annotatedValues returns the values for the package-level variables that
+// are annotated with //govvv: comments in the non-standard packages of list.
+// Variables of main packages are keyed as "main.Name", the name the linker
+// uses for them.
+func annotatedValues(list []goListPackage, dir string, values map[string]string) (map[string]string, []targetProblem, error) {
+	vars, err := annotatedVariables(list, dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	out := make(map[string]string)
+	var problems []targetProblem
+	for _, v := range vars {
+		problem := targetProblem{key: v.key, pos: v.pos, warn: true}
+		value, ok, err := sourceValue(v.source, values)
+		switch {
+		case err != nil:
+			problem.msg = fmt.Sprintf("has an invalid %s annotation: %v", annotationPrefix, err)
+			problems = append(problems, problem)
+		case !ok:
+			problem.msg = fmt.Sprintf("is not set: there is no value for %s%s", annotationPrefix, v.source)
+			problem.warn = false
+			problems = append(problems, problem)
+		default:
+			out[v.key] = value
+		}
+	}
+	return out, problems, nil
+}
+
+// annotatedVariable is a variable annotated with a //govvv: comment.
+type annotatedVariable struct {
+	key    string // as in annotatedValues
+	pos    string // file:line of the declaration
+	source string // text after the prefix
+}
+
+// annotatedVariables returns the variables annotated with //govvv: comments
+// in the non-standard packages of list, in the order they are declared.
+func annotatedVariables(list []goListPackage, dir string) ([]annotatedVariable, error) {
+	var out []annotatedVariable
+	for _, p := range list {
+		if p.Standard {
+			continue
+		}
+		pkg := p.ImportPath
+		if p.Name == "main" {
+			pkg = defaultPackage
+		}
+		for _, name := range append(append([]string(nil), p.GoFiles...), p.CgoFiles...) {
+			vars, err := fileAnnotatedVariables(filepath.Join(p.Dir, name), pkg, dir)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, vars...)
+		}
+	}
+	return out, nil
+}
+
+// fileAnnotatedVariables returns the variables annotated with //govvv:
+// comments in the file fp of package pkg, with positions relative to dir.
+func fileAnnotatedVariables(fp, pkg, dir string) ([]annotatedVariable, error) {
+	src, err := ioutil.ReadFile(fp)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Contains(src, []byte(annotationPrefix)) {
+		return nil, nil
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, fp, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	var out []annotatedVariable
+	for _, a := range fileAnnotations(f) {
+		out = append(out, annotatedVariable{pkg + "." + a.name, relPos(dir, fset.Position(a.pos)), a.source})
+	}
+	return out, nil
+}
+
+// skippedAnnotations reports the variables annotated with //govvv: comments
+// in the packages built from pkgs in dir with the build flags, for the modes
+// that do not set them: "govvv test", -const-file and -flags. It is best
+// effort; nothing is reported if the packages cannot be loaded.
+func skippedAnnotations(dir string, flags, pkgs []string) []targetProblem {
+	list, err := listPackages(dir, flags, pkgs)
+	if err != nil {
+		return nil
+	}
+	vars, err := annotatedVariables(list, dir)
+	if err != nil {
+		return nil
+	}
+	return skippedVariables(vars)
+}
+
+// skippedDirAnnotations is skippedAnnotations for the package in dir alone,
+// for "govvv generate". The files are only parsed, not type-checked, and the
+// ones the default build context excludes are ignored.
+func skippedDirAnnotations(dir string) []targetProblem {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil
+	}
+	var vars []annotatedVariable
+	for _, fp := range files {
+		name := filepath.Base(fp)
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		if ok, err := build.Default.MatchFile(dir, name); err != nil || !ok {
+			continue
+		}
+		pkg, err := goPackageName(fp)
+		if err != nil {
+			continue
+		}
+		v, err := fileAnnotatedVariables(fp, pkg, dir)
+		if err != nil {
+			continue
+		}
+		vars = append(vars, v...)
+	}
+	return skippedVariables(vars)
+}
+
+// skippedVariables reports vars as not set.
+func skippedVariables(vars []annotatedVariable) []targetProblem {
+	var out []targetProblem
+	for _, v := range vars {
+		out = append(out, targetProblem{key: v.key, pos: v.pos, warn: true,
+			msg: fmt.Sprintf(`is not set: %s annotations only apply to "build", "install" and "run" without %s`, annotationPrefix, flConstFile)})
+	}
+	return out
+}
+
+// annotation is a //govvv: comment on a package-level variable.
+type annotation struct {
+	name   string    // variable name
+	source string    // text after the prefix
+	pos    token.Pos // position of the variable
+}
+
+// fileAnnotations returns the //govvv: comments on the package-level
+// variables of f. A comment on a var declaration applies to all of its
+// variables unless it is parenthesized, like //go:embed comments.
+func fileAnnotations(f *ast.File) []annotation {
+	var out []annotation
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			vs := spec.(*ast.ValueSpec)
+			doc := vs.Doc
+			if doc == nil && !gen.Lparen.IsValid() {
+				doc = gen.Doc
+			}
+			if doc == nil {
+				continue
+			}
+			for _, c := range doc.List {
+				if !strings.HasPrefix(c.Text, annotationPrefix) {
+					continue
+				}
+				for _, n := range vs.Names {
+					out = append(out, annotation{n.Name, strings.TrimPrefix(c.Text, annotationPrefix), n.Pos()})
+				}
+			}
+		}
+	}
+	return out
+}
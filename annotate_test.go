@@ -0,0 +1,154 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_sourceValue(t *testing.T) {
+	values := map[string]string{
+		"main.Version":   "1.0.0",
+		"main.GitCommit": "abc1234",
+		"main.GitBranch": "master",
+	}
+	cases := []struct {
+		source string
+		value  string
+		ok     bool
+		err    bool
+	}{
+		{"commit", "abc1234", true, false},
+		{"version", "1.0.0", true, false},
+		{"change-id", "", false, false},
+		{`value "{{.Version}}+{{.GitCommit}}"`, "1.0.0+abc1234", true, false},
+		{"value `{{.GitBranch}}`", "master", true, false},
+		{`value "{{.ChangeID}}"`, "", false, true},
+		{"value {{.Version}}", "", false, true},
+		{`value "{{.Version"`, "", false, true},
+		{"commit abc", "", false, true},
+		{"bogus", "", false, true},
+	}
+	for _, c := range cases {
+		value, ok, err := sourceValue(c.source, values)
+		require.Equal(t, c.err, err != nil, "source %q: %v", c.source, err)
+		require.Equal(t, c.ok, ok, "source %q", c.source)
+		require.Equal(t, c.value, value, "source %q", c.source)
+	}
+}
+
+func Test_annotatedValues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "govvv-test")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	require.Nil(t, os.Mkdir(filepath.Join(dir, "build"), 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte(`package main
+
+//govvv:commit
+var Revision string
+
+var (
+	//govvv:value "{{.Version}}-{{.GitBranch}}"
+	Full string
+
+	//govvv:bogus
+	Bad string
+
+	//govvv:change-id
+	CL string
+
+	// Plain is not annotated.
+	Plain string
+)
+
+//govvv:summary
+var A, B string
+
+func main() {
+	//govvv:commit
+	var local string
+	_ = local
+}
+`), 0644))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "build", "build.go"), []byte(`package build
+
+// BuiltAt is the time of the build.
+//
+//govvv:build-date
+var BuiltAt string
+`), 0644))
+
+	list := []goListPackage{
+		{ImportPath: "fmt", Name: "fmt", Dir: "/nonexistent", GoFiles: []string{"print.go"}, Standard: true},
+		{ImportPath: "app/build", Name: "build", Dir: filepath.Join(dir, "build"), GoFiles: []string{"build.go"}},
+		{ImportPath: "app", Name: "main", Dir: dir, GoFiles: []string{"main.go"}},
+	}
+	values := map[string]string{
+		"main.Version":    "1.0.0",
+		"main.GitCommit":  "abc1234",
+		"main.GitBranch":  "master",
+		"main.GitSummary": "v1.0.0",
+		"main.BuildDate":  "2017-01-01T00:00:00Z",
+	}
+	out, problems, err := annotatedValues(list, dir, values)
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{
+		"app/build.BuiltAt": "2017-01-01T00:00:00Z",
+		"main.Revision":     "abc1234",
+		"main.Full":         "1.0.0-master",
+		"main.A":            "v1.0.0",
+		"main.B":            "v1.0.0",
+	}, out)
+	require.Len(t, problems, 2)
+	require.Equal(t, `main.go:11: main.Bad has an invalid //govvv: annotation: unknown value "bogus"`, problems[0].String())
+	require.True(t, problems[0].warn)
+	require.Equal(t, "main.go:14: main.CL is not set: there is no value for //govvv:change-id", problems[1].String())
+	require.False(t, problems[1].warn)
+}
+
+func Test_skippedAnnotations(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs go list")
+	}
+	dir, err := ioutil.TempDir("", "govvv-test")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module app\n"), 0644))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte(`package main
+
+//govvv:commit
+var Revision string
+
+var GitCommit string
+
+func main() {}
+`), 0644))
+
+	problems := skippedAnnotations(dir, nil, []string{"."})
+	require.Len(t, problems, 1)
+	require.Equal(t, `main.go:4: main.Revision is not set: //govvv: annotations only apply to "build", "install" and "run" without -const-file`, problems[0].String())
+	require.True(t, problems[0].warn)
+
+	// best effort
+	require.Empty(t, skippedAnnotations(dir, nil, []string{"./missing"}))
+}
+
+func Test_skippedDirAnnotations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "govvv-test")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	for name, src := range map[string]string{
+		"build.go":      "package build\n\n//govvv:commit\nvar Revision string\n",
+		"build_test.go": "package build\n\n//govvv:commit\nvar TestRevision string\n",
+		"ignored.go":    "//go:build ignore\n\npackage build\n\n//govvv:commit\nvar IgnoredRevision string\n",
+	} {
+		require.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644))
+	}
+
+	problems := skippedDirAnnotations(dir)
+	require.Len(t, problems, 1)
+	require.Equal(t, `build.go:4: build.Revision is not set: //govvv: annotations only apply to "build", "install" and "run" without -const-file`, problems[0].String())
+}
@@ -0,0 +1,570 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// configFiles are the names of the project configuration file, in order of
+// preference.
+var configFiles = []string{".govvv.yaml", ".govvv.yml", ".govvv.toml"}
+
+// envPrefix starts the names of the environment variables that set
+// directives, e.g. GOVVV_DATE_SOURCE for -date-source.
+const envPrefix = "GOVVV_"
+
+// configDirectives are the directives that can be set in the configuration
+// file and the environment, with their kind.
+var configDirectives = map[string]configKind{
+	flPackage:      configString,
+	flVersion:      configString,
+	flVersionFile:  configPath,
+	flDateSource:   configString,
+	flDateFormat:   configList,
+	flDateTimezone: configList,
+	flPrecedence:   configString,
+	flConstFile:    configPath,
+	flVerify:       configBool,
+	flStrict:       configBool,
+	flTarget:       configList,
+}
+
+// configKind is the type of the value of a configuration key.
+type configKind int
+
+const (
+	configString configKind = iota
+	configPath              // a path, relative to the configuration file
+	configBool
+	configList // the directive can be repeated
+)
+
+// origins of the settings
+const (
+	originEnvironment = "environment"
+	originDefault     = "default"
+)
+
+// configLayer is a set of directives from one origin: the configuration file,
+// the environment or the command line.
+type configLayer struct {
+	origin string
+	values map[string][]string // by directive, "true" or "false" for booleans
+}
+
+// settings are the directives in effect.
+type settings struct {
+	file    string              // configuration file, if any
+	values  map[string][]string // by directive
+	origins map[string]string   // origin of each directive
+}
+
+// loadSettings returns the directives in effect for the go command run in
+// dir with args, from (in increasing order of precedence) the configuration
+// file, the GOVVV_* environment variables and the directives in args. Each
+// layer replaces the values of the directives it sets, including the ones
+// that can be repeated.
+func loadSettings(dir string, args []string) (settings, error) {
+	var layers []configLayer
+	fp, ok := findConfigFile(dir)
+	if ok {
+		l, err := readConfigFile(fp)
+		if err != nil {
+			return settings{}, err
+		}
+		layers = append(layers, l)
+	}
+	env, err := envLayer(os.LookupEnv)
+	if err != nil {
+		return settings{}, err
+	}
+	layers = append(layers, env, argsLayer(args))
+
+	s := settings{file: fp, values: make(map[string][]string), origins: make(map[string]string)}
+	for _, l := range layers {
+		for d, v := range l.values {
+			s.values[d], s.origins[d] = v, l.origin
+		}
+	}
+	return s, nil
+}
+
+// directives returns the settings as directives, as in the arguments of
+// govvv.
+func (s settings) directives() []string {
+	var names []string
+	for d := range s.values {
+		names = append(names, d)
+	}
+	sort.Strings(names)
+
+	var out []string
+	for _, d := range names {
+		if !govvvDirectives[d] {
+			if s.values[d][0] == "true" {
+				out = append(out, d)
+			}
+			continue
+		}
+		for _, v := range s.values[d] {
+			out = append(out, d, v)
+		}
+	}
+	return out
+}
+
+// argsLayer returns the directives in args.
+func argsLayer(args []string) configLayer {
+	l := configLayer{origin: originCommandLine, values: make(map[string][]string)}
+	for i := 0; i < len(args); i++ {
+		hasArgument, ok := govvvDirectives[args[i]]
+		switch {
+		case !ok:
+		case !hasArgument:
+			l.values[args[i]] = []string{"true"}
+		case i+1 < len(args):
+			l.values[args[i]] = append(l.values[args[i]], args[i+1])
+			i++
+		}
+	}
+	return l
+}
+
+// envVar returns the name of the environment variable for directive.
+func envVar(directive string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(directive[1:], "-", "_", -1))
+}
+
+// envLayer returns the directives set with GOVVV_* environment variables.
+// Directives that can be repeated take one value per line. Empty variables
+// are ignored.
+func envLayer(lookup func(string) (string, bool)) (configLayer, error) {
+	l := configLayer{origin: originEnvironment, values: make(map[string][]string)}
+	for d, kind := range configDirectives {
+		v, ok := lookup(envVar(d))
+		if !ok || strings.TrimSpace(v) == "" {
+			continue
+		}
+		switch kind {
+		case configBool:
+			b, err := strconv.ParseBool(strings.TrimSpace(v))
+			if err != nil {
+				return l, fmt.Errorf("invalid %s: %q is not a boolean", envVar(d), v)
+			}
+			l.values[d] = []string{strconv.FormatBool(b)}
+		case configList:
+			for _, line := range strings.Split(v, "\n") {
+				if line = strings.TrimSpace(line); line != "" {
+					l.values[d] = append(l.values[d], line)
+				}
+			}
+		default:
+			l.values[d] = []string{v}
+		}
+	}
+	return l, nil
+}
+
+// findConfigFile looks for a configuration file in the root of the module dir
+// belongs to (or dir, outside modules) and its parents.
+func findConfigFile(dir string) (string, bool) {
+	d := moduleRoot(dir)
+	for {
+		for _, name := range configFiles {
+			fp := filepath.Join(d, name)
+			if fi, err := os.Stat(fp); err == nil && !fi.IsDir() {
+				return fp, true
+			}
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return "", false
+		}
+		d = parent
+	}
+}
+
+// moduleRoot returns the closest directory to dir that has a go.mod file, or
+// dir if there is none.
+func moduleRoot(dir string) string {
+	for d := dir; ; {
+		if _, err := os.Stat(filepath.Join(d, "go.mod")); err == nil {
+			return d
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return dir
+		}
+		d = parent
+	}
+}
+
+// readConfigFile reads the configuration file fp, in YAML or TOML depending
+// on its extension. Only top-level keys with strings, booleans and lists of
+// strings as values are supported.
+func readConfigFile(fp string) (configLayer, error) {
+	l := configLayer{origin: fp, values: make(map[string][]string)}
+	b, err := ioutil.ReadFile(fp)
+	if err != nil {
+		return l, fmt.Errorf("failed to read config file: %v", err)
+	}
+	var entries []configEntry
+	if filepath.Ext(fp) == ".toml" {
+		entries, err = parseTOMLConfig(string(b))
+	} else {
+		entries, err = parseYAMLConfig(string(b))
+	}
+	if err != nil {
+		return l, fmt.Errorf("%s:%v", fp, err)
+	}
+
+	for _, e := range entries {
+		d := "-" + e.key
+		kind, ok := configDirectives[d]
+		if !ok {
+			return l, fmt.Errorf("%s:%d: unknown key %q", fp, e.line, e.key)
+		}
+		if e.list && kind != configList {
+			return l, fmt.Errorf("%s:%d: %s takes a single value", fp, e.line, e.key)
+		}
+		switch kind {
+		case configBool:
+			b, err := strconv.ParseBool(e.values[0])
+			if err != nil || e.quoted {
+				return l, fmt.Errorf("%s:%d: %s takes true or false", fp, e.line, e.key)
+			}
+			l.values[d] = []string{strconv.FormatBool(b)}
+		case configPath:
+			p := e.values[0]
+			if !filepath.IsAbs(p) {
+				p = filepath.Join(filepath.Dir(fp), p)
+			}
+			l.values[d] = []string{p}
+		case configList:
+			l.values[d] = e.values
+			if d != flTarget {
+				continue
+			}
+			// package directories are relative to the file too
+			for i, target := range e.values {
+				if pkg, _, _, ok := splitTarget(target); ok && isPackageDir(pkg) && !filepath.IsAbs(pkg) {
+					e.values[i] = filepath.Join(filepath.Dir(fp), pkg) + target[len(pkg):]
+				}
+			}
+		default:
+			l.values[d] = e.values
+		}
+	}
+	return l, nil
+}
+
+// configEntry is a key of a configuration file.
+type configEntry struct {
+	key    string
+	values []string
+	list   bool // the value is a list
+	quoted bool // the value is a quoted string
+	line   int
+}
+
+// parseYAMLConfig parses the YAML subset of configuration files: "key: value"
+// lines, with values as plain or quoted scalars, flow sequences ("[a, b]") or
+// block sequences ("- a" on the following lines).
+func parseYAMLConfig(src string) ([]configEntry, error) {
+	var entries []configEntry
+	var last *configEntry // the entry block sequence items belong to
+	sc := bufio.NewScanner(strings.NewReader(src))
+	for n := 1; sc.Scan(); n++ {
+		line := stripConfigComment(sc.Text(), true)
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "" || trimmed == "---":
+			continue
+		case strings.HasPrefix(trimmed, "- ") || trimmed == "-":
+			if last == nil || line[0] != ' ' && line[0] != '-' {
+				return nil, fmt.Errorf("%d: unexpected list item", n)
+			}
+			v, _, err := parseConfigScalar(strings.TrimSpace(trimmed[1:]), true)
+			if err != nil {
+				return nil, fmt.Errorf("%d: %v", n, err)
+			}
+			last.values = append(last.values, v)
+			continue
+		case line[0] == ' ' || line[0] == '\t':
+			return nil, fmt.Errorf("%d: nested values are not supported", n)
+		}
+
+		i := strings.Index(line, ":")
+		if i == -1 {
+			return nil, fmt.Errorf("%d: want \"key: value\"", n)
+		}
+		e := configEntry{key: strings.TrimSpace(line[:i]), line: n}
+		value := strings.TrimSpace(line[i+1:])
+		last = nil
+		var err error
+		switch {
+		case value == "":
+			e.list, last = true, &e
+		case strings.HasPrefix(value, "["):
+			e.list = true
+			e.values, err = parseConfigList(value, true)
+		default:
+			var v string
+			v, e.quoted, err = parseConfigScalar(value, true)
+			e.values = []string{v}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%d: %v", n, err)
+		}
+		entries = append(entries, e)
+		if last != nil {
+			last = &entries[len(entries)-1]
+		}
+	}
+	return entries, sc.Err()
+}
+
+// parseTOMLConfig parses the TOML subset of configuration files: "key =
+// value" lines, with strings, booleans and arrays of strings as values.
+// Arrays can span several lines.
+func parseTOMLConfig(src string) ([]configEntry, error) {
+	var entries []configEntry
+	lines := strings.Split(src, "\n")
+	for n := 0; n < len(lines); n++ {
+		line := strings.TrimSpace(stripConfigComment(lines[n], false))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			return nil, fmt.Errorf("%d: tables are not supported", n+1)
+		}
+		i := strings.Index(line, "=")
+		if i == -1 {
+			return nil, fmt.Errorf("%d: want \"key = value\"", n+1)
+		}
+		e := configEntry{key: strings.TrimSpace(line[:i]), line: n + 1}
+		if k, err := strconv.Unquote(e.key); err == nil {
+			e.key = k
+		}
+		value := strings.TrimSpace(line[i+1:])
+		var err error
+		if strings.HasPrefix(value, "[") {
+			for !strings.HasSuffix(value, "]") && n+1 < len(lines) {
+				n++
+				value += " " + strings.TrimSpace(stripConfigComment(lines[n], false))
+			}
+			e.list = true
+			e.values, err = parseConfigList(value, false)
+		} else {
+			var v string
+			v, e.quoted, err = parseConfigScalar(value, false)
+			e.values = []string{v}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%d: %v", e.line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// parseConfigList parses a list of scalars in brackets, "[a, "b", 'c']", as
+// in parseConfigScalar.
+func parseConfigList(s string, yaml bool) ([]string, error) {
+	if !strings.HasSuffix(s, "]") {
+		return nil, fmt.Errorf("unterminated list %s", s)
+	}
+	s = strings.TrimSpace(s[1 : len(s)-1])
+	var out []string
+	for s != "" {
+		end := strings.Index(s, ",")
+		if s[0] == '"' || s[0] == '\'' {
+			end = closingQuote(s, yaml)
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated string %s", s)
+			}
+			end++
+			if rest := strings.TrimSpace(s[end:]); rest != "" && rest[0] != ',' {
+				return nil, fmt.Errorf("unexpected %s after string", rest)
+			}
+			if i := strings.Index(s[end:], ","); i != -1 {
+				end += i
+			} else {
+				end = len(s)
+			}
+		}
+		if end == -1 {
+			end = len(s)
+		}
+		v, _, err := parseConfigScalar(strings.TrimSpace(s[:end]), yaml)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+		if end < len(s) {
+			end++ // the comma
+		}
+		s = strings.TrimSpace(s[end:])
+	}
+	return out, nil
+}
+
+// parseConfigScalar parses a plain, double-quoted (with Go escapes) or
+// single-quoted value. Single-quoted values have no escapes, except for a
+// doubled quote in yaml.
+func parseConfigScalar(s string, yaml bool) (value string, quoted bool, err error) {
+	if s == "" {
+		return "", false, nil
+	}
+	switch s[0] {
+	case '"':
+		if closingQuote(s, yaml) != len(s)-1 {
+			return "", false, fmt.Errorf("invalid string %s", s)
+		}
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return "", false, fmt.Errorf("invalid string %s", s)
+		}
+		return v, true, nil
+	case '\'':
+		if closingQuote(s, yaml) != len(s)-1 {
+			return "", false, fmt.Errorf("invalid string %s", s)
+		}
+		if !yaml {
+			return s[1 : len(s)-1], true, nil
+		}
+		return strings.Replace(s[1:len(s)-1], "''", "'", -1), true, nil
+	}
+	return s, false, nil
+}
+
+// closingQuote returns the index of the quote that closes the string s starts
+// with, or -1.
+func closingQuote(s string, yaml bool) int {
+	q := s[0]
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && q == '"':
+			i++
+		case s[i] == q && q == '\'' && yaml && i+1 < len(s) && s[i+1] == '\'':
+			i++ // '' is an escaped quote
+		case s[i] == q:
+			return i
+		}
+	}
+	return -1
+}
+
+// stripConfigComment removes a "#" comment from line, unless it is in a
+// quoted string.
+func stripConfigComment(line string, yaml bool) string {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '"', '\'':
+			end := closingQuote(line[i:], yaml)
+			if end == -1 {
+				return line
+			}
+			i += end
+		case '#':
+			if i == 0 || line[i-1] == ' ' || line[i-1] == '\t' {
+				return strings.TrimRight(line[:i], " \t")
+			}
+		}
+	}
+	return line
+}
+
+// runConfig implements "govvv config show", which prints the settings in
+// effect in dir as a configuration file.
+func runConfig(w io.Writer, dir string, args []string) error {
+	cmd := parseGoCommand(args)
+	rest := scrubGovvvDirectives(args[cmd.subcmd+1:])
+	if len(rest) != 1 || rest[0] != "show" {
+		return fmt.Errorf("usage: govvv config show")
+	}
+	s, err := loadSettings(dir, args)
+	if err != nil {
+		return err
+	}
+	writeSettings(w, s)
+	return nil
+}
+
+// writeSettings writes the configurable settings in s in YAML, with their
+// origins as comments.
+func writeSettings(w io.Writer, s settings) {
+	if s.file != "" {
+		fmt.Fprintf(w, "# config file: %s\n", s.file)
+	} else {
+		fmt.Fprintf(w, "# config file: none (%s)\n", strings.Join(configFiles, ", "))
+	}
+	var names []string
+	for d := range configDirectives {
+		names = append(names, d)
+	}
+	sort.Strings(names)
+	for _, d := range names {
+		key := d[1:]
+		values, ok := s.values[d]
+		origin := s.origins[d]
+		if !ok {
+			values, origin = configDefault(d), originDefault
+		}
+		if origin != originCommandLine && origin != originDefault && origin != originEnvironment {
+			origin = filepath.Base(origin)
+		} else if origin == originEnvironment {
+			origin = envVar(d)
+		}
+		switch {
+		case configDirectives[d] == configList:
+			if len(values) == 0 {
+				fmt.Fprintf(w, "%s: []  # %s\n", key, origin)
+				continue
+			}
+			fmt.Fprintf(w, "%s:  # %s\n", key, origin)
+			for _, v := range values {
+				fmt.Fprintf(w, "  - %s\n", yamlScalar(v))
+			}
+		case len(values) == 0:
+			fmt.Fprintf(w, "# %s:  # not set\n", key)
+		case configDirectives[d] == configBool:
+			fmt.Fprintf(w, "%s: %s  # %s\n", key, values[0], origin)
+		default:
+			fmt.Fprintf(w, "%s: %s  # %s\n", key, yamlScalar(values[0]), origin)
+		}
+	}
+}
+
+// configDefault returns the value of directive d when it is not set.
+func configDefault(d string) []string {
+	switch d {
+	case flPackage:
+		return []string{defaultPackage}
+	case flVersionFile:
+		return []string{versionFile}
+	case flDateSource:
+		return []string{dateSourceNow}
+	case flPrecedence:
+		return []string{precedenceUser}
+	case flVerify, flStrict:
+		return []string{"false"}
+	}
+	return nil
+}
+
+// yamlScalar returns s as a YAML scalar, quoted if needed.
+func yamlScalar(s string) string {
+	if s == "" || strings.ContainsAny(s, "\"'#:{}[],&*!|>%@`\\\n\t") || s != strings.TrimSpace(s) ||
+		s[0] == '-' || s == "true" || s == "false" {
+		return strconv.Quote(s)
+	}
+	return s
+}
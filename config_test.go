@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseYAMLConfig(t *testing.T) {
+	entries, err := parseYAMLConfig(`# govvv settings
+---
+pkg: github.com/acme/app/internal/build  # trailing comment
+version: "1.0.0 # not a comment"
+strict: true
+date-format: [BuildUnix=unix, 'CommitDate=2006-01-02']
+target:
+  - main.Version=version
+  - "main.Full=value \"{{.Version}}+{{.GitCommit}}\""
+  - 'main.Quote=value "it''s"'
+date-tz:
+`)
+	require.Nil(t, err)
+	require.Equal(t, []configEntry{
+		{key: "pkg", values: []string{"github.com/acme/app/internal/build"}, line: 3},
+		{key: "version", values: []string{"1.0.0 # not a comment"}, quoted: true, line: 4},
+		{key: "strict", values: []string{"true"}, line: 5},
+		{key: "date-format", values: []string{"BuildUnix=unix", "CommitDate=2006-01-02"}, list: true, line: 6},
+		{key: "target", values: []string{
+			"main.Version=version",
+			`main.Full=value "{{.Version}}+{{.GitCommit}}"`,
+			`main.Quote=value "it's"`,
+		}, list: true, line: 7},
+		{key: "date-tz", list: true, line: 11},
+	}, entries)
+
+	for _, src := range []string{
+		"pkg",
+		"  - orphan",
+		"pkg:\n  nested: value",
+		`version: "unterminated`,
+		"target: [a, b",
+	} {
+		_, err := parseYAMLConfig(src)
+		require.NotNil(t, err, "config %q", src)
+	}
+}
+
+func Test_parseTOMLConfig(t *testing.T) {
+	entries, err := parseTOMLConfig(`# govvv settings
+pkg = "github.com/acme/app/internal/build" # trailing comment
+"version-file" = 'build/VERSION'
+strict = false
+target = [
+  "main.Version=version", # the version
+  'main.Revision=commit',
+]
+`)
+	require.Nil(t, err)
+	require.Equal(t, []configEntry{
+		{key: "pkg", values: []string{"github.com/acme/app/internal/build"}, quoted: true, line: 2},
+		{key: "version-file", values: []string{"build/VERSION"}, quoted: true, line: 3},
+		{key: "strict", values: []string{"false"}, line: 4},
+		{key: "target", values: []string{"main.Version=version", "main.Revision=commit"}, list: true, line: 5},
+	}, entries)
+
+	for _, src := range []string{
+		"[govvv]\npkg = \"main\"",
+		"pkg",
+		`target = ["a" "b"]`,
+		`version = 'it''s'`, // literal strings have no escapes
+		`target = ['it''s']`,
+	} {
+		_, err := parseTOMLConfig(src)
+		require.NotNil(t, err, "config %q", src)
+	}
+}
+
+func Test_readConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "govvv-test")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	fp := filepath.Join(dir, ".govvv.yaml")
+
+	require.Nil(t, ioutil.WriteFile(fp, []byte(`version-file: build/VERSION
+strict: true
+target: [main.Version=version, ./cmd/app.Revision=commit]
+`), 0644))
+	l, err := readConfigFile(fp)
+	require.Nil(t, err)
+	require.Equal(t, fp, l.origin)
+	require.Equal(t, map[string][]string{
+		flVersionFile: {filepath.Join(dir, "build/VERSION")}, // relative to the file
+		flStrict:      {"true"},
+		flTarget:      {"main.Version=version", filepath.Join(dir, "cmd/app") + ".Revision=commit"},
+	}, l.values)
+
+	for src, msg := range map[string]string{
+		"bogus: 1":                  `:1: unknown key "bogus"`,
+		"print: true":               `:1: unknown key "print"`,
+		"pkg: [a, b]":               ":1: pkg takes a single value",
+		"strict: yes please":        ":1: strict takes true or false",
+		"strict: \"true\"":          ":1: strict takes true or false",
+		"version: 1\n  nested: 2\n": ":2: nested values are not supported",
+	} {
+		require.Nil(t, ioutil.WriteFile(fp, []byte(src), 0644))
+		_, err := readConfigFile(fp)
+		require.NotNil(t, err, "config %q", src)
+		require.Contains(t, err.Error(), fp+msg)
+	}
+}
+
+func Test_envLayer(t *testing.T) {
+	env := map[string]string{
+		"GOVVV_DATE_SOURCE": "commit",
+		"GOVVV_STRICT":      "1",
+		"GOVVV_VERIFY":      "false",
+		"GOVVV_TARGET":      "main.Version=version\n\n  main.Revision=commit\n",
+		"GOVVV_PKG":         "",
+		"GOVVV_PRINT":       "true",
+	}
+	l, err := envLayer(func(k string) (string, bool) { v, ok := env[k]; return v, ok })
+	require.Nil(t, err)
+	require.Equal(t, originEnvironment, l.origin)
+	require.Equal(t, map[string][]string{
+		flDateSource: {"commit"},
+		flStrict:     {"true"},
+		flVerify:     {"false"},
+		flTarget:     {"main.Version=version", "main.Revision=commit"},
+	}, l.values)
+
+	env = map[string]string{"GOVVV_STRICT": "sometimes"}
+	_, err = envLayer(func(k string) (string, bool) { v, ok := env[k]; return v, ok })
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "invalid GOVVV_STRICT")
+}
+
+func Test_loadSettings(t *testing.T) {
+	root, err := ioutil.TempDir("", "govvv-test")
+	require.Nil(t, err)
+	defer os.RemoveAll(root)
+	mod := filepath.Join(root, "mod")
+	dir := filepath.Join(mod, "cmd", "app")
+	require.Nil(t, os.MkdirAll(dir, 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(mod, "go.mod"), []byte("module app\n"), 0644))
+	for _, k := range []string{"GOVVV_PKG", "GOVVV_DATE_SOURCE", "GOVVV_TARGET", "GOVVV_STRICT"} {
+		defer os.Setenv(k, os.Getenv(k))
+		os.Unsetenv(k)
+	}
+
+	// no config file
+	s, err := loadSettings(dir, []string{"build", "-print"})
+	require.Nil(t, err)
+	require.Equal(t, "", s.file)
+	require.Equal(t, []string{flDryRun}, s.directives())
+
+	// found from the module root upward, but not below it
+	require.Nil(t, ioutil.WriteFile(filepath.Join(root, ".govvv.toml"), []byte(`pkg = "app/build"
+date-source = "now"
+strict = true
+target = ["main.Version=version", "main.Revision=commit"]
+`), 0644))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, ".govvv.yaml"), []byte("pkg: ignored\n"), 0644))
+	s, err = loadSettings(dir, []string{"build"})
+	require.Nil(t, err)
+	require.Equal(t, filepath.Join(root, ".govvv.toml"), s.file)
+	require.Equal(t, []string{
+		flDateSource, "now",
+		flPackage, "app/build",
+		flStrict,
+		flTarget, "main.Version=version",
+		flTarget, "main.Revision=commit",
+	}, s.directives())
+
+	// the environment overrides the config file, and the command line the
+	// environment. each replaces all the values of a directive.
+	os.Setenv("GOVVV_DATE_SOURCE", "commit")
+	os.Setenv("GOVVV_STRICT", "false")
+	os.Setenv("GOVVV_TARGET", "main.Version=version")
+	os.Setenv("GOVVV_PKG", "app/env")
+	s, err = loadSettings(dir, []string{"build", "-pkg", "app/cli", "-target", "Revision=commit", "-target", "Branch=branch", "."})
+	require.Nil(t, err)
+	require.Equal(t, []string{
+		flDateSource, "commit",
+		flPackage, "app/cli",
+		flTarget, "Revision=commit",
+		flTarget, "Branch=branch",
+	}, s.directives())
+	require.Equal(t, originEnvironment, s.origins[flDateSource])
+	require.Equal(t, originCommandLine, s.origins[flPackage])
+
+	// errors in the config file are reported
+	require.Nil(t, ioutil.WriteFile(filepath.Join(root, ".govvv.toml"), []byte("pkg = [\"a\"]\n"), 0644))
+	_, err = loadSettings(dir, []string{"build"})
+	require.NotNil(t, err)
+}
+
+func Test_writeSettings(t *testing.T) {
+	s := settings{
+		file: "/src/app/.govvv.yaml",
+		values: map[string][]string{
+			flPackage:    {"app/build"},
+			flStrict:     {"true"},
+			flDateSource: {"commit"},
+			flTarget:     {"main.Version=version", `main.Full=value "{{.Version}}"`},
+			flDryRun:     {"true"},
+		},
+		origins: map[string]string{
+			flPackage:    "/src/app/.govvv.yaml",
+			flStrict:     originEnvironment,
+			flDateSource: originCommandLine,
+			flTarget:     "/src/app/.govvv.yaml",
+			flDryRun:     originCommandLine,
+		},
+	}
+	var b bytes.Buffer
+	writeSettings(&b, s)
+	requireGolden(t, "config-show", b.String())
+
+	// the output can be read back
+	entries, err := parseYAMLConfig(b.String())
+	require.Nil(t, err)
+	require.Len(t, entries, len(configDirectives)-2) // without the unset ones
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// envSourceDateEPOCH is the environment variable specified by
+	// https://reproducible-builds.org/specs/source-date-epoch/ to replace the
+	// current time in build outputs.
+	envSourceDateEPOCH = "SOURCE_DATE_EPOCH"
+)
+
+// values of the -date-source directive
+const (
+	dateSourceNow    = "now"
+	dateSourceCommit = "commit"
+)
+
+// buildTime returns the time the build is stamped with. With the "commit"
+// date source (set by the -date-source directive, or GOVVV_DATE_SOURCE in the
+// environment), it is the time the checked out revision was committed, so
+// that builds of the same revision are identical. Otherwise it is the time in
+// SOURCE_DATE_EPOCH if set, or the current time.
+func buildTime(repo vcs, args []string) (time.Time, error) {
+	source, _ := collectGovvvDirective(args, flDateSource)
+	switch source {
+	case dateSourceCommit:
+		t, err := repo.CommitDate()
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to get commit date: %v", err)
+		}
+		return t, nil
+	case dateSourceNow, "":
+		if epoch := os.Getenv(envSourceDateEPOCH); epoch != "" {
+			t, err := parseUnixTime(epoch)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("invalid %s: %v", envSourceDateEPOCH, err)
+			}
+			return t, nil
+		}
+		return time.Now(), nil
+	default:
+		return time.Time{}, fmt.Errorf("unknown date source %q (must be %q or %q)", source, dateSourceNow, dateSourceCommit)
+	}
+}
+
+// date variables
+const (
+	varBuildDate  = "BuildDate"
+	varBuildUnix  = "BuildUnix"
+	varCommitDate = "CommitDate"
+)
+
+// named presets of the -date-format directive
+const (
+	dateFormatRFC3339      = "rfc3339"
+	dateFormatRFC3339Nano  = "rfc3339nano"
+	dateFormatUnix         = "unix"
+	dateFormatISO8601Basic = "iso8601-basic"
+)
+
+// dateLayouts maps the named presets to time layouts. The "unix" preset has no
+// layout and formats dates as Unix seconds.
+var dateLayouts = map[string]string{
+	dateFormatRFC3339:      time.RFC3339,
+	dateFormatRFC3339Nano:  time.RFC3339Nano,
+	dateFormatISO8601Basic: "20060102T150405Z0700",
+	dateFormatUnix:         "",
+}
+
+// dateVarDefaults maps the date variables to their default format.
+// BuildUnix always defaults to Unix seconds, and is not affected by a
+// -date-format directive that is not specific to it.
+var dateVarDefaults = map[string]string{
+	varBuildDate:  dateFormatRFC3339,
+	varBuildUnix:  dateFormatUnix,
+	varCommitDate: dateFormatRFC3339,
+}
+
+// formatDateVar formats t for the date variable name using its default
+// format, overridden by the -date-format and -date-tz directives, which either
+// apply to all date variables ("-date-format unix") or to a single one
+// ("-date-format BuildDate=unix").
+func formatDateVar(args []string, name string, t time.Time) (string, error) {
+	format := dateVarDefaults[name]
+	if v, ok := dateVarDirective(args, flDateFormat, name); ok && (name != varBuildUnix || v.specific) {
+		format = v.value
+	}
+	loc := time.UTC
+	if v, ok := dateVarDirective(args, flDateTimezone, name); ok {
+		l, err := time.LoadLocation(v.value)
+		if err != nil {
+			return "", fmt.Errorf("invalid timezone for %s: %v", name, err)
+		}
+		loc = l
+	}
+	return formatDate(t.In(loc), format), nil
+}
+
+// dateDirectiveValue is the value of a -date-format or -date-tz directive and
+// whether it is specific to a variable.
+type dateDirectiveValue struct {
+	value    string
+	specific bool
+}
+
+// dateVarDirective returns the last value of the directive that applies to the
+// date variable name. Values specific to the variable take precedence over
+// the ones that apply to all date variables.
+func dateVarDirective(args []string, directive, name string) (v dateDirectiveValue, ok bool) {
+	for _, arg := range collectGovvvDirectives(args, directive) {
+		if i := strings.Index(arg, "="); i != -1 {
+			if _, isVar := dateVarDefaults[arg[:i]]; isVar {
+				if arg[:i] == name {
+					v, ok = dateDirectiveValue{arg[i+1:], true}, true
+				}
+				continue
+			}
+		}
+		if !v.specific {
+			v, ok = dateDirectiveValue{arg, false}, true
+		}
+	}
+	return v, ok
+}
+
+// formatDate formats t with a named preset or a time layout.
+func formatDate(t time.Time, format string) string {
+	if format == dateFormatUnix {
+		return strconv.FormatInt(t.Unix(), 10)
+	}
+	if layout, ok := dateLayouts[format]; ok {
+		format = layout
+	}
+	return t.Format(format)
+}
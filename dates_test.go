@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_date(t *testing.T) {
+	v := formatDate(time.Now().UTC(), dateFormatRFC3339)
+	require.Regexp(t, "^[0-9]{4}(-[0-9]{2}){2}T([0-9]{2}:){2}[0-9]{2}Z$", v)
+}
+
+func Test_buildTime(t *testing.T) {
+	repo := newRepo(t)
+	defer os.RemoveAll(repo.dir)
+	mkCommit(t, repo, "commit 1")
+	commitDate, err := repo.CommitDate()
+	require.Nil(t, err)
+
+	defer os.Setenv(envSourceDateEPOCH, os.Getenv(envSourceDateEPOCH))
+	os.Unsetenv(envSourceDateEPOCH)
+
+	// current time
+	before := time.Now().Add(-time.Second)
+	v, err := buildTime(repo, []string{})
+	require.Nil(t, err)
+	require.True(t, v.After(before))
+
+	// SOURCE_DATE_EPOCH
+	os.Setenv(envSourceDateEPOCH, "1500000000")
+	v, err = buildTime(repo, []string{})
+	require.Nil(t, err)
+	require.Equal(t, "2017-07-14T02:40:00Z", formatDate(v.UTC(), dateFormatRFC3339))
+
+	// commit date
+	v, err = buildTime(repo, []string{flDateSource, "commit"})
+	require.Nil(t, err)
+	require.Equal(t, formatDate(commitDate.UTC(), dateFormatRFC3339), formatDate(v.UTC(), dateFormatRFC3339))
+
+	v, err = buildTime(repo, []string{flDateSource, "now"})
+	require.Nil(t, err)
+	require.Equal(t, "2017-07-14T02:40:00Z", formatDate(v.UTC(), dateFormatRFC3339))
+
+	// errors
+	_, err = buildTime(repo, []string{flDateSource, "yesterday"})
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "unknown date source")
+
+	os.Setenv(envSourceDateEPOCH, "soon")
+	_, err = buildTime(repo, []string{flDateSource, "now"})
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "invalid SOURCE_DATE_EPOCH")
+}
+
+func Test_formatDate(t *testing.T) {
+	d := time.Date(2017, 7, 14, 2, 40, 0, 500, time.UTC)
+	cases := []struct {
+		format, out string
+	}{
+		{"rfc3339", "2017-07-14T02:40:00Z"},
+		{"rfc3339nano", "2017-07-14T02:40:00.0000005Z"},
+		{"unix", "1500000000"},
+		{"iso8601-basic", "20170714T024000Z"},
+		{"Jan 2, 2006", "Jul 14, 2017"},
+	}
+	for _, c := range cases {
+		require.Equal(t, c.out, formatDate(d, c.format), "format=%q", c.format)
+	}
+}
+
+func Test_formatDateVar(t *testing.T) {
+	d := time.Unix(1500000000, 0)
+	cases := []struct {
+		args []string
+		name string
+		out  string
+	}{
+		{[]string{}, varBuildDate, "2017-07-14T02:40:00Z"},
+		{[]string{}, varBuildUnix, "1500000000"},
+		{[]string{}, varCommitDate, "2017-07-14T02:40:00Z"},
+
+		// applies to all variables but BuildUnix
+		{[]string{flDateFormat, "2006-01-02"}, varBuildDate, "2017-07-14"},
+		{[]string{flDateFormat, "2006-01-02"}, varCommitDate, "2017-07-14"},
+		{[]string{flDateFormat, "2006-01-02"}, varBuildUnix, "1500000000"},
+
+		// specific to a variable, regardless of the order
+		{[]string{flDateFormat, "CommitDate=unix", flDateFormat, "2006"}, varCommitDate, "1500000000"},
+		{[]string{flDateFormat, "CommitDate=unix", flDateFormat, "2006"}, varBuildDate, "2017"},
+		{[]string{flDateFormat, "BuildUnix=rfc3339"}, varBuildUnix, "2017-07-14T02:40:00Z"},
+
+		// last one wins
+		{[]string{flDateFormat, "unix", flDateFormat, "2006"}, varBuildDate, "2017"},
+
+		// timezones
+		{[]string{flDateTimezone, "Asia/Tokyo"}, varBuildDate, "2017-07-14T11:40:00+09:00"},
+		{[]string{flDateTimezone, "BuildDate=Asia/Tokyo"}, varCommitDate, "2017-07-14T02:40:00Z"},
+		{[]string{flDateTimezone, "America/New_York", flDateFormat, "Jan 2 15:04 MST"}, varBuildDate, "Jul 13 22:40 EDT"},
+	}
+	for _, c := range cases {
+		out, err := formatDateVar(c.args, c.name, d)
+		require.Nil(t, err)
+		require.Equal(t, c.out, out, "name=%s args=%#v", c.name, c.args)
+	}
+
+	_, err := formatDateVar([]string{flDateTimezone, "Mars/Olympus_Mons"}, varBuildDate, d)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "invalid timezone for BuildDate")
+}
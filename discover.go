@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// goListPackage is the part of the "go list -json" output govvv uses.
+type goListPackage struct {
+	ImportPath string
+	Name       string
+	Dir        string
+	Export     string
+	GoFiles    []string
+	CgoFiles   []string
+	ImportMap  map[string]string
+	DepOnly    bool
+	Standard   bool
+}
+
+// listPackages returns pkgs and their dependencies, as listed by the go tool
+// in dir with the build flags, with the export data of the dependencies built.
+func listPackages(dir string, flags, pkgs []string) ([]goListPackage, error) {
+	args := append([]string{"list", "-json", "-export", "-deps"}, flags...)
+	out, err := execIn(dir, "go", append(args, pkgs...)...)
+	if err != nil {
+		return nil, err
+	}
+	var list []goListPackage
+	dec := json.NewDecoder(strings.NewReader(out))
+	for {
+		var p goListPackage
+		if err := dec.Decode(&p); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("cannot parse go list output: %v", err)
+		}
+		list = append(list, p)
+	}
+	return list, nil
+}
+
+// targetProblem is a reason for not setting a variable with -X.
+type targetProblem struct {
+	key  string
+	pos  string // file:line of the declaration, if any
+	msg  string
+	warn bool // false if the variable is simply not declared
+}
+
+func (p targetProblem) String() string {
+	if p.pos == "" {
+		return fmt.Sprintf("%s %s", p.key, p.msg)
+	}
+	return fmt.Sprintf("%s: %s %s", p.pos, p.key, p.msg)
+}
+
+// typedPackage is a type-checked package.
+type typedPackage struct {
+	*goListPackage
+	fset  *token.FileSet
+	files []*ast.File
+	types *types.Package
+	info  *types.Info
+}
+
+// typeCheck parses and type-checks p, importing its dependencies from their
+// export data. Type errors are ignored, the go tool reports them.
+func typeCheck(p *goListPackage, exports map[string]string) (*typedPackage, error) {
+	tp := &typedPackage{
+		goListPackage: p,
+		fset:          token.NewFileSet(),
+		info:          &types.Info{Types: make(map[ast.Expr]types.TypeAndValue)},
+	}
+	for _, name := range append(append([]string(nil), p.GoFiles...), p.CgoFiles...) {
+		f, err := parser.ParseFile(tp.fset, filepath.Join(p.Dir, name), nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		tp.files = append(tp.files, f)
+	}
+	imp := importer.ForCompiler(tp.fset, "gc", func(path string) (io.ReadCloser, error) {
+		if mapped, ok := p.ImportMap[path]; ok {
+			path = mapped
+		}
+		if exports[path] == "" {
+			return nil, fmt.Errorf("no export data for %s", path)
+		}
+		return os.Open(exports[path])
+	})
+	conf := types.Config{Importer: imp, FakeImportC: true, Error: func(error) {}}
+	tp.types, _ = conf.Check(p.ImportPath, tp.fset, tp.files, tp.info)
+	return tp, nil
+}
+
+// initializer returns the expression the package-level variable name is
+// initialized with, or nil if it has none. multi is true if it is one of the
+// results of a function call.
+func (tp *typedPackage) initializer(name string) (expr ast.Expr, multi bool) {
+	for _, f := range tp.files {
+		for _, decl := range f.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.VAR {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				vs := spec.(*ast.ValueSpec)
+				for i, n := range vs.Names {
+					if n.Name != name || len(vs.Values) == 0 {
+						continue
+					}
+					if len(vs.Values) != len(vs.Names) {
+						return vs.Values[0], true
+					}
+					return vs.Values[i], false
+				}
+			}
+		}
+	}
+	return nil, false
+}
+
+// checkTarget returns whether -X key can set the variable name in tp, or why
+// not.
+func (tp *typedPackage) checkTarget(key, name, dir string) (ok bool, problem targetProblem) {
+	problem.key = key
+	obj := tp.types.Scope().Lookup(name)
+	if obj == nil {
+		problem.msg = fmt.Sprintf("is not declared in %s", tp.ImportPath)
+		return false, problem
+	}
+	problem.pos, problem.warn = relPos(dir, tp.fset.Position(obj.Pos())), true
+
+	v, isVar := obj.(*types.Var)
+	if !isVar {
+		problem.msg = "is not a variable, -X only sets string variables"
+		return false, problem
+	}
+	if t := v.Type(); t == types.Typ[types.Invalid] {
+		return true, problem // cannot tell, let the linker decide
+	} else if !types.Identical(t, types.Typ[types.String]) {
+		problem.msg = fmt.Sprintf("has type %s, -X only sets string variables", t)
+		return false, problem
+	}
+	expr, multi := tp.initializer(name)
+	if expr == nil {
+		return true, problem
+	}
+	if tv, ok := tp.info.Types[expr]; !multi && ok && (tv.Value != nil || tv.Type == types.Typ[types.Invalid]) {
+		return true, problem
+	}
+	problem.msg = "is initialized with a non-constant expression, -X would have no effect"
+	return false, problem
+}
+
+// relPos returns pos as file:line, with the file relative to dir if it is in
+// dir.
+func relPos(dir string, pos token.Position) string {
+	if rel, err := filepath.Rel(dir, pos.Filename); err == nil && !strings.HasPrefix(rel, "..") {
+		pos.Filename = rel
+	}
+	return fmt.Sprintf("%s:%d", pos.Filename, pos.Line)
+}
+
+// discoverTargets type-checks the packages built from pkgs in dir with the
+// build flags (see listFlags) and returns the values for the variables that -X
+// can set: package-level string variables that are not initialized with
+// non-constant expressions. Keys of the "main" package refer to the main
+// packages being built. The variables of the optional packages are not
+// reported as problems if none of them is declared.
+//
+// The variables annotated with //govvv: comments in the packages of the build
+// are set too, to the collected values in sources (see annotatedValues). They
+// take precedence over values, unless values are explicit (chosen with
+// -target), in which case missing variables are reported as problems as well.
+func discoverTargets(dir string, flags, pkgs []string, values, sources map[string]string, explicit bool, optional map[string]bool) (map[string]string, []targetProblem, error) {
+	list, err := listPackages(dir, flags, pkgs)
+	if err != nil {
+		return nil, nil, err
+	}
+	annotated, annotationProblems, err := annotatedValues(list, dir, sources)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(annotated) > 0 {
+		merged := make(map[string]string)
+		for k, v := range annotated {
+			merged[k] = v
+		}
+		for k, v := range values {
+			if _, ok := merged[k]; !ok || explicit {
+				merged[k] = v
+			}
+		}
+		values = merged
+	}
+
+	exports := make(map[string]string)
+	byPath := make(map[string]*goListPackage)
+	var mains []*goListPackage
+	for i := range list {
+		p := &list[i]
+		exports[p.ImportPath], byPath[p.ImportPath] = p.Export, p
+		if !p.DepOnly && p.Name == "main" {
+			mains = append(mains, p)
+		}
+	}
+
+	// group the keys by package
+	keys := make(map[string][]string)
+	for key := range values {
+		pkg := key[:strings.LastIndex(key, ".")]
+		keys[pkg] = append(keys[pkg], key)
+	}
+
+	out := make(map[string]string)
+	var problems []targetProblem
+	for pkg, pkgKeys := range keys {
+		sort.Strings(pkgKeys)
+		targets := mains
+		if pkg != defaultPackage {
+			targets = nil
+			if p, ok := byPath[pkg]; ok {
+				targets = []*goListPackage{p}
+			}
+		}
+		if len(targets) == 0 {
+			if !optional[pkg] {
+				problems = append(problems, targetProblem{key: pkg, msg: "is not a package of the build", warn: true})
+			}
+			continue
+		}
+
+		var pkgProblems []targetProblem
+		declared := false
+		for _, target := range targets {
+			tp, err := typeCheck(target, exports)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, key := range pkgKeys {
+				ok, problem := tp.checkTarget(key, key[len(pkg)+1:], dir)
+				if ok {
+					out[key] = values[key]
+				} else {
+					pkgProblems = append(pkgProblems, problem)
+				}
+				declared = declared || ok || problem.warn
+			}
+		}
+		if !declared {
+			if !optional[pkg] {
+				problems = append(problems, targetProblem{key: pkg,
+					msg: "does not declare any of the variables govvv sets", warn: true})
+			}
+			continue
+		}
+		for _, p := range pkgProblems {
+			if _, set := out[p.key]; !set {
+				p.warn = p.warn || explicit
+				problems = append(problems, p)
+			}
+		}
+	}
+	for _, p := range annotationProblems {
+		if _, set := out[p.key]; !set {
+			problems = append(problems, p)
+		}
+	}
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].key < problems[j].key })
+	return out, problems, nil
+}
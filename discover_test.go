@@ -0,0 +1,172 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_discoverTargets(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs go list")
+	}
+	dir, err := ioutil.TempDir("", "govvv-test")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module app\n"), 0644))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte(`package main
+
+import (
+	"os"
+	"strings"
+)
+
+const GitBranch = "master"
+
+const prefix = "v"
+
+var (
+	Version              = prefix + "0.0.0"
+	GitCommit            string
+	GitState             = os.Getenv("STATE")
+	GitSummary           = strings.ToUpper(Version)
+	BuildUnix            int64
+	BuildDate, ChangeID = pair()
+)
+
+func pair() (string, string) { return "", "" }
+
+func main() {}
+`), 0644))
+
+	values := map[string]string{
+		"main.Version": "1.0.0", "main.GitCommit": "abc", "main.GitBranch": "b",
+		"main.GitState": "clean", "main.GitSummary": "abc", "main.BuildUnix": "0",
+		"main.BuildDate": "d", "main.ChangeID": "c", "main.CommitDate": "d",
+	}
+	out, problems, err := discoverTargets(dir, nil, []string{"."}, values, values, false, nil)
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{"main.Version": "1.0.0", "main.GitCommit": "abc"}, out)
+
+	var got []string
+	for _, p := range problems {
+		got = append(got, p.String())
+	}
+	got[3] = regexp.MustCompile(`in \S+$`).ReplaceAllString(got[3], "in app") // "_/tmp/..." without modules
+	require.Equal(t, []string{
+		"main.go:18: main.BuildDate is initialized with a non-constant expression, -X would have no effect",
+		"main.go:17: main.BuildUnix has type int64, -X only sets string variables",
+		"main.go:18: main.ChangeID is initialized with a non-constant expression, -X would have no effect",
+		"main.CommitDate is not declared in app",
+		"main.go:8: main.GitBranch is not a variable, -X only sets string variables",
+		"main.go:15: main.GitState is initialized with a non-constant expression, -X would have no effect",
+		"main.go:16: main.GitSummary is initialized with a non-constant expression, -X would have no effect",
+	}, got)
+	require.False(t, problems[3].warn)
+
+	// a package that is not built, or declares none of the variables
+	others := map[string]string{"example.com/nope.Version": "1.0.0", "main.Other": "x"}
+	out, problems, err = discoverTargets(dir, nil, []string{"."}, others, values, false, nil)
+	require.Nil(t, err)
+	require.Empty(t, out)
+	require.Len(t, problems, 2)
+	require.Equal(t, "example.com/nope is not a package of the build", problems[0].String())
+	require.Equal(t, "main does not declare any of the variables govvv sets", problems[1].String())
+
+	// unless they are optional
+	_, problems, err = discoverTargets(dir, nil, []string{"."}, others, values, false,
+		map[string]bool{"example.com/nope": true, "main": true})
+	require.Nil(t, err)
+	require.Empty(t, problems)
+
+	// explicit targets are expected to exist
+	out, problems, err = discoverTargets(dir, nil, []string{"."}, map[string]string{
+		"main.GitCommit": "abc", "main.Revision": "abc"}, values, true, nil)
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{"main.GitCommit": "abc"}, out)
+	require.Len(t, problems, 1)
+	require.Regexp(t, `^main.Revision is not declared in \S+$`, problems[0].String())
+	require.True(t, problems[0].warn)
+
+	_, _, err = discoverTargets(dir, nil, []string{"./missing"}, values, values, false, nil)
+	require.NotNil(t, err)
+}
+
+func Test_discoverTargets_buildFlags(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs go list")
+	}
+	dir, err := ioutil.TempDir("", "govvv-test")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module app\n"), 0644))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "v_prod.go"), []byte(`//go:build prod
+
+package main
+
+var GitCommit string
+`), 0644))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "v_dev.go"), []byte(`//go:build !prod
+
+package main
+
+import "os"
+
+var GitCommit = os.Getenv("COMMIT")
+`), 0644))
+	values := map[string]string{"main.GitCommit": "abc"}
+
+	// the files of the build are checked, not the default ones
+	out, problems, err := discoverTargets(dir, []string{"-tags=prod"}, []string{"."}, values, values, false, nil)
+	require.Nil(t, err)
+	require.Equal(t, values, out)
+	require.Empty(t, problems)
+
+	out, problems, err = discoverTargets(dir, nil, []string{"."}, values, values, false, nil)
+	require.Nil(t, err)
+	require.Empty(t, out)
+	require.Len(t, problems, 1)
+	require.Equal(t, "v_dev.go:7: main.GitCommit is initialized with a non-constant expression, -X would have no effect", problems[0].String())
+}
+
+func Test_discoverTargets_annotations(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs go list")
+	}
+	dir, err := ioutil.TempDir("", "govvv-test")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module app\n"), 0644))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte(`package main
+
+//govvv:summary
+var GitCommit string
+
+//govvv:commit
+var Revision string
+
+//govvv:version
+var Release string
+
+func main() {}
+`), 0644))
+	sources := map[string]string{"main.GitCommit": "abc", "main.GitSummary": "v1-abc"}
+
+	// annotations take precedence over the default variables
+	out, problems, err := discoverTargets(dir, nil, []string{"."}, sources, sources, false, nil)
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{"main.GitCommit": "v1-abc", "main.Revision": "abc"}, out)
+	require.Len(t, problems, 2)
+	require.Regexp(t, `^main.GitSummary is not declared`, problems[0].String())
+	require.Equal(t, "main.go:10: main.Release is not set: there is no value for //govvv:version", problems[1].String())
+
+	// but not over -target
+	out, _, err = discoverTargets(dir, nil, []string{"."}, map[string]string{"main.GitCommit": "abc"}, sources, true, nil)
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{"main.GitCommit": "abc", "main.Revision": "abc"}, out)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// fossilHashLen is the number of characters of a check-in hash fossil
+// displays by default.
+const fossilHashLen = 10
+
+type fossil struct {
+	dir string
+}
+
+func (f fossil) exec(args ...string) (string, error) {
+	return execIn(f.dir, "fossil", args...)
+}
+
+// info returns the fields of "fossil info" keyed by their names.
+func (f fossil) info() (map[string]string, error) {
+	out, err := f.exec("info")
+	if err != nil {
+		return nil, err
+	}
+	return parseFossilInfo(out), nil
+}
+
+// Commit returns the short hash of the current check-in.
+func (f fossil) Commit() (string, error) {
+	info, err := f.info()
+	if err != nil {
+		return "", err
+	}
+	return fossilCommit(info)
+}
+
+// State returns the checkout state indicating whether it is "clean" or
+// "dirty". Files that are not under version control make it dirty, same as
+// untracked files in git.
+func (f fossil) State() (string, error) {
+	for _, cmd := range []string{"changes", "extras"} {
+		out, err := f.exec(cmd)
+		if err != nil {
+			return "", err
+		}
+		if len(out) > 0 {
+			return "dirty", nil
+		}
+	}
+	return "clean", nil
+}
+
+// Branch returns the branch of the current check-in. If an error occurs,
+// returns "HEAD".
+func (f fossil) Branch() string {
+	out, err := f.exec("branch", "current")
+	if err != nil || out == "" {
+		return "HEAD"
+	}
+	return out
+}
+
+// Summary returns the first tag of the current check-in other than its
+// branch, or the short check-in hash if there is none, followed by "-dirty"
+// if there are local changes.
+func (f fossil) Summary() (string, error) {
+	info, err := f.info()
+	if err != nil {
+		return "", err
+	}
+	summary, err := fossilCommit(info)
+	if err != nil {
+		return "", err
+	}
+	branch := f.Branch()
+	for _, tag := range strings.Split(info["tags"], ",") {
+		if tag = strings.TrimSpace(tag); tag != "" && tag != branch {
+			summary = tag
+			break
+		}
+	}
+	state, err := f.State()
+	if err != nil {
+		return "", err
+	}
+	if state == "dirty" {
+		summary += "-dirty"
+	}
+	return summary, nil
+}
+
+// CommitDate returns the time of the current check-in.
+func (f fossil) CommitDate() (time.Time, error) {
+	info, err := f.info()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return fossilCommitDate(info)
+}
+
+// parseFossilInfo parses the "key: value" lines printed by "fossil info".
+func parseFossilInfo(out string) map[string]string {
+	info := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		i := strings.Index(line, ":")
+		if i == -1 {
+			continue
+		}
+		info[strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+	}
+	return info
+}
+
+// fossilCommit returns the short check-in hash from the "checkout" field of
+// "fossil info", which has the form "<hash> <date> <time> UTC".
+func fossilCommit(info map[string]string) (string, error) {
+	f := strings.Fields(info["checkout"])
+	if len(f) == 0 {
+		return "", fmt.Errorf("fossil: cannot find checkout in info output")
+	}
+	hash := f[0]
+	if len(hash) > fossilHashLen {
+		hash = hash[:fossilHashLen]
+	}
+	return hash, nil
+}
+
+// fossilCommitDate returns the check-in time from the "checkout" field of
+// "fossil info".
+func fossilCommitDate(info map[string]string) (time.Time, error) {
+	f := strings.Fields(info["checkout"])
+	if len(f) < 3 {
+		return time.Time{}, fmt.Errorf("fossil: cannot find checkout date in info output")
+	}
+	t, err := time.Parse("2006-01-02 15:04:05", f[1]+" "+f[2])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("fossil: invalid checkout date: %v", err)
+	}
+	return t, nil
+}
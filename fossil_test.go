@@ -0,0 +1,79 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const fossilInfoOutput = `project-name: <unnamed>
+repository:   /tmp/repo.fossil
+local-root:   /tmp/wc/
+config-db:    /root/.config/fossil.db
+project-code: 8c3fd3a4e4d4b1d7f2a2a8d5c9b3c4a2e1f0d9c8
+checkout:     5b4ba1f0e4c7a3b5a9e2d1c0f9e8d7c6b5a4f3e2d1c0b9a8f7e6d5c4b3a2f1e0 2024-01-02 03:04:05 UTC
+parent:       a1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8f90 2024-01-01 00:00:00 UTC
+tags:         trunk, v1.2.0
+comment:      release (user: dev)
+check-ins:    2
+`
+
+func Test_parseFossilInfo(t *testing.T) {
+	info := parseFossilInfo(fossilInfoOutput)
+	require.Equal(t, "trunk, v1.2.0", info["tags"])
+	require.Equal(t, "/tmp/wc/", info["local-root"])
+
+	c, err := fossilCommit(info)
+	require.Nil(t, err)
+	require.Equal(t, "5b4ba1f0e4", c)
+
+	d, err := fossilCommitDate(info)
+	require.Nil(t, err)
+	require.Equal(t, "2024-01-02T03:04:05Z", d.Format(time.RFC3339))
+
+	_, err = fossilCommit(parseFossilInfo("project-name: foo\n"))
+	require.NotNil(t, err)
+	_, err = fossilCommitDate(parseFossilInfo("project-name: foo\n"))
+	require.NotNil(t, err)
+}
+
+func TestFossil(t *testing.T) {
+	if _, err := exec.LookPath("fossil"); err != nil {
+		t.Skip("fossil is not installed")
+	}
+	dir := tmpDir(t)
+	defer os.RemoveAll(dir)
+
+	wc := filepath.Join(dir, "wc")
+	require.Nil(t, os.Mkdir(wc, 0755))
+	_, err := execIn(dir, "fossil", "init", filepath.Join(dir, "repo.fossil"))
+	require.Nil(t, err)
+	_, err = execIn(wc, "fossil", "open", filepath.Join(dir, "repo.fossil"))
+	require.Nil(t, err)
+
+	repo := fossil{wc}
+	require.IsType(t, fossil{}, detectVCS(wc))
+	require.Equal(t, "trunk", repo.Branch())
+
+	c, err := repo.Commit()
+	require.Nil(t, err)
+	require.Regexp(t, "^[0-9a-f]{10}$", c)
+
+	s, err := repo.State()
+	require.Nil(t, err)
+	require.Equal(t, "clean", s)
+
+	require.Nil(t, ioutil.WriteFile(filepath.Join(wc, "a"), []byte("a"), 0600))
+	s, err = repo.State()
+	require.Nil(t, err)
+	require.Equal(t, "dirty", s)
+
+	sum, err := repo.Summary()
+	require.Nil(t, err)
+	require.Equal(t, c+"-dirty", sum)
+}
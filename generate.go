@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+const defaultGenerateOutput = "zz_version.go"
+
+// generateOptions are the arguments of "govvv generate".
+type generateOptions struct {
+	dir      string // package directory (-pkg)
+	out      string // output file, relative to dir (-o)
+	template string // template file (-template)
+	check    bool   // only check that the output is up to date (-check)
+}
+
+// parseGenerateArgs parses the arguments of "govvv generate" (without the
+// program name), which can be mixed with govvv directives.
+func parseGenerateArgs(args []string) (generateOptions, error) {
+	opts := generateOptions{dir: ".", out: defaultGenerateOutput}
+	if pkg, ok := collectGovvvDirective(args, flPackage); ok {
+		opts.dir = pkg
+	}
+	cmd := parseGoCommand(args)
+	for i := cmd.subcmd + 1; i < len(args); i++ {
+		arg := args[i]
+		if hasArgument, ok := govvvDirectives[arg]; ok {
+			if hasArgument {
+				i++
+			}
+			continue
+		}
+		switch arg {
+		case "-check", "--check":
+			opts.check = true
+		case "-o", "--o", "-template", "--template":
+			if i+1 >= len(args) {
+				return opts, fmt.Errorf("flag needs an argument: %s", arg)
+			}
+			i++
+			if arg == "-o" || arg == "--o" {
+				opts.out = args[i]
+			} else {
+				opts.template = args[i]
+			}
+		default:
+			return opts, fmt.Errorf("unknown argument %q", arg)
+		}
+	}
+	return opts, nil
+}
+
+// runGenerate implements "govvv generate", which writes the values into a Go
+// file in a package, or checks that the Version in that file is up to date.
+func runGenerate(wd string, args []string) error {
+	opts, err := parseGenerateArgs(args)
+	if err != nil {
+		return err
+	}
+	dir := opts.dir
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(wd, dir)
+	}
+	out := opts.out
+	if !filepath.IsAbs(out) {
+		out = filepath.Join(dir, out)
+	}
+
+	cfg, err := loadSettings(dir, args)
+	if err != nil {
+		return err
+	}
+	values, err := GetFlags(versionFileDir(dir), cfg.directives())
+	if err != nil {
+		return fmt.Errorf("failed to collect values: %v", err)
+	}
+	if len(collectGovvvDirectives(cfg.directives(), flTarget)) > 0 {
+		values = packageValues(dir, values)
+	}
+	for _, p := range skippedDirAnnotations(dir) {
+		log.Printf("govvv: warning: %s", p)
+	}
+
+	if opts.check {
+		return checkGenerated(out, values)
+	}
+
+	tmpl := defaultGoFileTemplate
+	if opts.template != "" {
+		if tmpl, err = template.ParseFiles(opts.template); err != nil {
+			return fmt.Errorf("failed to read template: %v", err)
+		}
+	}
+	pkg, err := overlayPackageName(out)
+	if err != nil {
+		return err
+	}
+	f, err := newGoFile(pkg, values)
+	if err != nil {
+		return err
+	}
+	src, err := renderGoFile(tmpl, f)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(out, src, 0644)
+}
+
+// packageValues returns the values for the variables of the package in dir,
+// or all of them if its import path cannot be determined.
+func packageValues(dir string, values map[string]string) map[string]string {
+	path, err := execIn(dir, "go", "list", "-f", `{{if eq .Name "main"}}main{{else}}{{.ImportPath}}{{end}}`, ".")
+	if err != nil {
+		return values
+	}
+	prefix := strings.TrimSpace(path) + "."
+	out := make(map[string]string)
+	for k, v := range values {
+		if strings.HasPrefix(k, prefix) && !strings.Contains(k[len(prefix):], ".") {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// checkGenerated returns an error if the Version in the generated file fp
+// does not match the one in values.
+func checkGenerated(fp string, values map[string]string) error {
+	f, err := newGoFile("", values)
+	if err != nil {
+		return err
+	}
+	want, ok := f.Values["Version"]
+	if !ok {
+		return fmt.Errorf("no version to check %s against (no %s file or -version)", fp, versionFile)
+	}
+	got, err := goFileVersion(fp)
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return fmt.Errorf("%s is stale: it has Version %q, want %q (run \"govvv generate\")", fp, got, want)
+	}
+	return nil
+}
+
+// goFileVersion returns the value of the Version string constant or variable
+// declared in the Go source file fp.
+func goFileVersion(fp string) (string, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), fp, nil, 0)
+	if err != nil {
+		return "", err
+	}
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || (gen.Tok != token.CONST && gen.Tok != token.VAR) {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			vs := spec.(*ast.ValueSpec)
+			for i, name := range vs.Names {
+				if name.Name != "Version" || i >= len(vs.Values) {
+					continue
+				}
+				if lit, ok := vs.Values[i].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+					return strconv.Unquote(lit.Value)
+				}
+			}
+		}
+	}
+	return "", fmt.Errorf("%s does not declare a Version string", fp)
+}
+
+// versionFileDir returns the closest directory to dir, up to the root of its
+// module, that has a VERSION file, or dir if there is none.
+func versionFileDir(dir string) string {
+	for d := dir; ; {
+		if _, err := os.Stat(filepath.Join(d, versionFile)); err == nil {
+			return d
+		}
+		if _, err := os.Stat(filepath.Join(d, "go.mod")); err == nil {
+			break
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			break
+		}
+		d = parent
+	}
+	return dir
+}
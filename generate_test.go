@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseGenerateArgs(t *testing.T) {
+	opts, err := parseGenerateArgs([]string{"generate"})
+	require.Nil(t, err)
+	require.Equal(t, generateOptions{dir: ".", out: defaultGenerateOutput}, opts)
+
+	opts, err = parseGenerateArgs([]string{"-version", "1.0", "generate", "-pkg", "./internal/version",
+		"-o", "v.go", "-template", "t.tmpl", "-date-source", "commit", "-check"})
+	require.Nil(t, err)
+	require.Equal(t, generateOptions{dir: "./internal/version", out: "v.go", template: "t.tmpl", check: true}, opts)
+
+	_, err = parseGenerateArgs([]string{"generate", "-o"})
+	require.EqualError(t, err, "flag needs an argument: -o")
+	_, err = parseGenerateArgs([]string{"generate", "-x"})
+	require.EqualError(t, err, `unknown argument "-x"`)
+}
+
+func Test_goFileVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "govvv-test")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	fp := filepath.Join(dir, "v.go")
+	require.Nil(t, ioutil.WriteFile(fp, []byte("package v\n\nconst (\n\tA, Version = \"a\", `1.0`\n)\n"), 0644))
+	v, err := goFileVersion(fp)
+	require.Nil(t, err)
+	require.Equal(t, "1.0", v)
+
+	require.Nil(t, ioutil.WriteFile(fp, []byte("package v\n\nvar Version string\n"), 0644))
+	_, err = goFileVersion(fp)
+	require.NotNil(t, err)
+}
+
+func Test_checkGenerated(t *testing.T) {
+	dir, err := ioutil.TempDir("", "govvv-test")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	fp := filepath.Join(dir, "zz_version.go")
+	f, err := newGoFile("version", map[string]string{"main.Version": "1.0"})
+	require.Nil(t, err)
+	src, err := renderGoFile(defaultGoFileTemplate, f)
+	require.Nil(t, err)
+	require.Nil(t, ioutil.WriteFile(fp, src, 0644))
+
+	require.Nil(t, checkGenerated(fp, map[string]string{"main.Version": "1.0"}))
+	require.EqualError(t, checkGenerated(fp, map[string]string{"main.Version": "1.1"}),
+		fp+` is stale: it has Version "1.0", want "1.1" (run "govvv generate")`)
+	require.NotNil(t, checkGenerated(fp, map[string]string{}))
+	require.NotNil(t, checkGenerated(filepath.Join(dir, "missing.go"), map[string]string{"main.Version": "1.0"}))
+}
+
+func Test_versionFileDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "govvv-test")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	pkg := filepath.Join(dir, "mod", "internal", "version")
+	require.Nil(t, os.MkdirAll(pkg, 0755))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "mod", "go.mod"), []byte("module m\n"), 0644))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, versionFile), []byte("9.9\n"), 0644))
+
+	// not beyond the module root
+	require.Equal(t, pkg, versionFileDir(pkg))
+
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "mod", versionFile), []byte("1.0\n"), 0644))
+	require.Equal(t, filepath.Join(dir, "mod"), versionFileDir(pkg))
+
+	require.Nil(t, ioutil.WriteFile(filepath.Join(pkg, versionFile), []byte("1.0\n"), 0644))
+	require.Equal(t, pkg, versionFileDir(pkg))
+}
@@ -1,27 +1,13 @@
 package main
 
-import (
-	"bytes"
-	"fmt"
-	"os/exec"
-	"strings"
-)
+import "time"
 
 type git struct {
 	dir string
 }
 
 func (g git) exec(args ...string) (string, error) {
-	var errOut bytes.Buffer
-	c := exec.Command("git", args...)
-	c.Dir = g.dir
-	c.Stderr = &errOut
-	out, err := c.Output()
-	outStr := strings.TrimSpace(string(out))
-	if err != nil {
-		err = fmt.Errorf("git: error=%q stderr=%s", err, string(errOut.Bytes()))
-	}
-	return outStr, err
+	return execIn(g.dir, "git", args...)
 }
 
 // Commit returns the short git commit hash.
@@ -62,3 +48,12 @@ func (g git) Summary() (string, error) {
 	}
 	return out, err
 }
+
+// CommitDate returns the committer date of HEAD.
+func (g git) CommitDate() (time.Time, error) {
+	out, err := g.exec("show", "-s", "--format=%ct", "HEAD")
+	if err != nil {
+		return time.Time{}, err
+	}
+	return parseUnixTime(out)
+}
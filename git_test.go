@@ -5,6 +5,7 @@ import (
 	"os"
 	"os/exec"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -63,6 +64,21 @@ func TestState(t *testing.T) {
 	require.EqualValues(t, "clean", s3)
 }
 
+func TestCommitDate(t *testing.T) {
+	repo := newRepo(t)
+	defer os.RemoveAll(repo.dir)
+
+	_, err := repo.CommitDate()
+	require.NotNil(t, err)
+
+	before := time.Now().Add(-time.Second)
+	mkCommit(t, repo, "commit 1")
+	d, err := repo.CommitDate()
+	require.Nil(t, err)
+	require.True(t, d.After(before), "commit date %v", d)
+	require.Equal(t, time.UTC, d.Location())
+}
+
 func TestBranch(t *testing.T) {
 	repo := newRepo(t)
 	defer os.RemoveAll(repo.dir)
@@ -0,0 +1,795 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// gitNativeAbbrev is the length of the abbreviated commit hashes, matching
+// the default of "git rev-parse --short".
+const gitNativeAbbrev = 7
+
+// errObjectNotFound is returned when an object is in neither the loose object
+// store nor any of the packs.
+var errObjectNotFound = errors.New("object not found")
+
+// gitNative reads the repository metadata straight from the .git directory.
+// It is used when the git binary is not available, such as in minimal build
+// containers that only have the source tree.
+type gitNative struct {
+	dir string
+}
+
+// gitDirs locates the git directory of the working tree containing dir, and
+// the common directory that holds the objects and shared refs. The two are
+// different for linked worktrees.
+func (g gitNative) gitDirs() (gitDir, commonDir string, err error) {
+	abs, err := filepath.Abs(g.dir)
+	if err != nil {
+		return "", "", err
+	}
+	for d := abs; ; d = filepath.Dir(d) {
+		p := filepath.Join(d, ".git")
+		if fi, err := os.Stat(p); err == nil {
+			if fi.IsDir() {
+				gitDir = p
+			} else if gitDir, err = readGitDirFile(p); err != nil {
+				return "", "", err
+			}
+			break
+		}
+		if filepath.Dir(d) == d {
+			return "", "", fmt.Errorf("not a git repository: %s", g.dir)
+		}
+	}
+
+	commonDir = gitDir
+	if b, err := ioutil.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		commonDir = resolvePath(gitDir, string(bytes.TrimSpace(b)))
+	}
+	return gitDir, commonDir, nil
+}
+
+// readGitDirFile parses a ".git" file of the form "gitdir: <path>" used by
+// worktrees and submodules.
+func readGitDirFile(p string) (string, error) {
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return "", err
+	}
+	s := string(bytes.TrimSpace(b))
+	if !strings.HasPrefix(s, "gitdir:") {
+		return "", fmt.Errorf("invalid gitdir file %s", p)
+	}
+	return resolvePath(filepath.Dir(p), strings.TrimSpace(strings.TrimPrefix(s, "gitdir:"))), nil
+}
+
+// resolvePath returns p if it is absolute, or p relative to base otherwise.
+func resolvePath(base, p string) string {
+	if filepath.IsAbs(p) {
+		return filepath.Clean(p)
+	}
+	return filepath.Join(base, p)
+}
+
+// repo opens the repository for reading.
+func (g gitNative) repo() (*gitRepo, error) {
+	gitDir, commonDir, err := g.gitDirs()
+	if err != nil {
+		return nil, err
+	}
+	return &gitRepo{gitDir: gitDir, commonDir: commonDir}, nil
+}
+
+// Commit returns the short git commit hash.
+func (g gitNative) Commit() (string, error) {
+	r, err := g.repo()
+	if err != nil {
+		return "", err
+	}
+	id, err := r.resolve("HEAD")
+	if err != nil {
+		return "", err
+	}
+	return abbrev(id), nil
+}
+
+// State returns "unknown", as determining whether the working tree has
+// changes requires hashing it against the index.
+func (g gitNative) State() (string, error) {
+	return "unknown", nil
+}
+
+// Branch returns the branch name. If it is detached,
+// or an error occurs, returns "HEAD".
+func (g gitNative) Branch() string {
+	r, err := g.repo()
+	if err != nil {
+		return "HEAD"
+	}
+	target, ok, err := r.symbolicRef("HEAD")
+	if err != nil || !ok || !strings.HasPrefix(target, "refs/heads/") {
+		return "HEAD"
+	}
+	return strings.TrimPrefix(target, "refs/heads/")
+}
+
+// Summary returns the equivalent of "git describe --tags --always", without
+// the "-dirty" suffix since the state of the working tree is unknown.
+func (g gitNative) Summary() (string, error) {
+	r, err := g.repo()
+	if err != nil {
+		return "", err
+	}
+	head, err := r.resolve("HEAD")
+	if err != nil {
+		return "", err
+	}
+	return r.describe(head)
+}
+
+// CommitDate returns the committer date of HEAD.
+func (g gitNative) CommitDate() (time.Time, error) {
+	r, err := g.repo()
+	if err != nil {
+		return time.Time{}, err
+	}
+	head, err := r.resolve("HEAD")
+	if err != nil {
+		return time.Time{}, err
+	}
+	typ, data, err := r.object(head)
+	if err != nil {
+		return time.Time{}, err
+	}
+	committer, ok := objectHeader(data, "committer")
+	if typ != "commit" || !ok {
+		return time.Time{}, fmt.Errorf("cannot find committer of %s", head)
+	}
+	// "Name <email> <unix seconds> <timezone offset>"
+	f := strings.Fields(committer)
+	if len(f) < 2 {
+		return time.Time{}, fmt.Errorf("malformed committer of %s", head)
+	}
+	return parseUnixTime(f[len(f)-2])
+}
+
+// abbrev shortens a hex object name.
+func abbrev(id string) string {
+	if len(id) > gitNativeAbbrev {
+		return id[:gitNativeAbbrev]
+	}
+	return id
+}
+
+// gitRepo provides read access to refs and objects of a repository.
+type gitRepo struct {
+	gitDir, commonDir string
+
+	packed map[string]packedRef // lazily loaded packed-refs
+	packs  []*gitPack           // lazily loaded pack indexes
+}
+
+// packedRef is an entry of the packed-refs file. peeled is the object an
+// annotated tag points to, if recorded.
+type packedRef struct {
+	id, peeled string
+}
+
+// symbolicRef returns the target of the symbolic ref name, and whether name
+// is a symbolic ref at all.
+func (r *gitRepo) symbolicRef(name string) (string, bool, error) {
+	b, err := r.readLooseRef(name)
+	if err != nil {
+		return "", false, err
+	}
+	if strings.HasPrefix(b, "ref:") {
+		return strings.TrimSpace(strings.TrimPrefix(b, "ref:")), true, nil
+	}
+	return "", false, nil
+}
+
+// readLooseRef returns the contents of the loose ref file for name, which is
+// looked up in the worktree's git directory first. It returns an empty string
+// if there is no loose ref.
+func (r *gitRepo) readLooseRef(name string) (string, error) {
+	for _, dir := range []string{r.gitDir, r.commonDir} {
+		b, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err == nil {
+			return string(bytes.TrimSpace(b)), nil
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// resolve returns the object name the ref points to, following symbolic refs.
+func (r *gitRepo) resolve(name string) (string, error) {
+	for depth := 0; depth < 10; depth++ {
+		b, err := r.readLooseRef(name)
+		if err != nil {
+			return "", err
+		}
+		if strings.HasPrefix(b, "ref:") {
+			name = strings.TrimSpace(strings.TrimPrefix(b, "ref:"))
+			continue
+		}
+		if b != "" {
+			return b, nil
+		}
+		packed, err := r.packedRefs()
+		if err != nil {
+			return "", err
+		}
+		if p, ok := packed[name]; ok {
+			return p.id, nil
+		}
+		return "", fmt.Errorf("cannot resolve ref %s", name)
+	}
+	return "", fmt.Errorf("too many levels of symbolic refs resolving %s", name)
+}
+
+// packedRefs reads the packed-refs file of the repository.
+func (r *gitRepo) packedRefs() (map[string]packedRef, error) {
+	if r.packed != nil {
+		return r.packed, nil
+	}
+	r.packed = make(map[string]packedRef)
+	f, err := os.Open(filepath.Join(r.commonDir, "packed-refs"))
+	if os.IsNotExist(err) {
+		return r.packed, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var last string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := s.Text()
+		switch {
+		case line == "" || line[0] == '#':
+		case line[0] == '^' && last != "":
+			p := r.packed[last]
+			p.peeled = line[1:]
+			r.packed[last] = p
+		default:
+			f := strings.Fields(line)
+			if len(f) != 2 {
+				return nil, fmt.Errorf("malformed packed-refs line: %q", line)
+			}
+			r.packed[f[1]] = packedRef{id: f[0]}
+			last = f[1]
+		}
+	}
+	return r.packed, s.Err()
+}
+
+// tags returns the commits tagged by each tag name, peeling annotated tags.
+// annotated reports which of the tags are annotated.
+func (r *gitRepo) tags() (commits map[string]string, annotated map[string]bool, err error) {
+	commits, annotated = make(map[string]string), make(map[string]bool)
+	packed, err := r.packedRefs()
+	if err != nil {
+		return nil, nil, err
+	}
+	ids := make(map[string]string)
+	for name, p := range packed {
+		if !strings.HasPrefix(name, "refs/tags/") {
+			continue
+		}
+		if p.peeled != "" {
+			commits[name], annotated[name] = p.peeled, true
+			continue
+		}
+		ids[name] = p.id
+	}
+	tagsDir := filepath.Join(r.commonDir, "refs", "tags")
+	err = filepath.Walk(tagsDir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+		b, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(r.commonDir, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		delete(commits, name) // loose refs take precedence over packed ones
+		ids[name] = string(bytes.TrimSpace(b))
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for name, id := range ids {
+		commit, isTag, err := r.peel(id)
+		if err == errObjectNotFound {
+			continue
+		} else if err != nil {
+			return nil, nil, err
+		}
+		commits[name], annotated[name] = commit, isTag
+	}
+	return commits, annotated, nil
+}
+
+// peel follows annotated tag objects until it reaches a non-tag object, and
+// reports whether id was an annotated tag.
+func (r *gitRepo) peel(id string) (string, bool, error) {
+	isTag := false
+	for depth := 0; depth < 10; depth++ {
+		typ, data, err := r.object(id)
+		if err != nil {
+			return "", false, err
+		}
+		if typ != "tag" {
+			return id, isTag, nil
+		}
+		isTag = true
+		target, ok := objectHeader(data, "object")
+		if !ok {
+			return "", false, fmt.Errorf("tag %s has no object", id)
+		}
+		id = target
+	}
+	return "", false, fmt.Errorf("too many levels of tags peeling %s", id)
+}
+
+// parents returns the parent commits of the commit id.
+func (r *gitRepo) parents(id string) ([]string, error) {
+	typ, data, err := r.object(id)
+	if err != nil {
+		return nil, err
+	}
+	if typ != "commit" {
+		return nil, fmt.Errorf("object %s is a %s, not a commit", id, typ)
+	}
+	var parents []string
+	for _, line := range headerLines(data) {
+		if strings.HasPrefix(line, "parent ") {
+			parents = append(parents, strings.TrimPrefix(line, "parent "))
+		}
+	}
+	return parents, nil
+}
+
+// describe names the commit after the closest tag reachable from it, the
+// same way "git describe --tags --always" does.
+func (r *gitRepo) describe(head string) (string, error) {
+	tags, annotated, err := r.tags()
+	if err != nil {
+		return "", err
+	}
+	byCommit := make(map[string][]string)
+	for name, commit := range tags {
+		byCommit[commit] = append(byCommit[commit], strings.TrimPrefix(name, "refs/tags/"))
+	}
+	for _, names := range byCommit {
+		sort.Slice(names, func(i, j int) bool {
+			ai, aj := annotated["refs/tags/"+names[i]], annotated["refs/tags/"+names[j]]
+			if ai != aj {
+				return ai // prefer annotated tags
+			}
+			return names[i] < names[j]
+		})
+	}
+
+	// find the closest tagged ancestor with a breadth-first walk
+	tagged := ""
+	seen := map[string]bool{head: true}
+	for queue := []string{head}; len(queue) > 0 && tagged == ""; queue = queue[1:] {
+		id := queue[0]
+		if _, ok := byCommit[id]; ok {
+			tagged = id
+			break
+		}
+		parents, err := r.parents(id)
+		if err != nil {
+			return "", err
+		}
+		for _, p := range parents {
+			if !seen[p] {
+				seen[p] = true
+				queue = append(queue, p)
+			}
+		}
+	}
+	if tagged == "" {
+		return abbrev(head), nil
+	}
+	tag := byCommit[tagged][0]
+	if tagged == head {
+		return tag, nil
+	}
+
+	// count the commits reachable from head that are not reachable from
+	// the tag, like git does.
+	excluded, err := r.ancestors(tagged, nil)
+	if err != nil {
+		return "", err
+	}
+	included, err := r.ancestors(head, excluded)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s-%d-g%s", tag, len(included), abbrev(head)), nil
+}
+
+// ancestors returns the set of commits reachable from id, including itself,
+// without walking past commits in stop.
+func (r *gitRepo) ancestors(id string, stop map[string]bool) (map[string]bool, error) {
+	set := make(map[string]bool)
+	for stack := []string{id}; len(stack) > 0; {
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if set[c] || stop[c] {
+			continue
+		}
+		set[c] = true
+		parents, err := r.parents(c)
+		if err != nil {
+			return nil, err
+		}
+		stack = append(stack, parents...)
+	}
+	return set, nil
+}
+
+// headerLines returns the header lines of a commit or tag object, which
+// precede the message.
+func headerLines(data []byte) []string {
+	if i := bytes.Index(data, []byte("\n\n")); i != -1 {
+		data = data[:i]
+	}
+	return strings.Split(string(data), "\n")
+}
+
+// objectHeader returns the value of the named header of a commit or tag
+// object.
+func objectHeader(data []byte, name string) (string, bool) {
+	for _, line := range headerLines(data) {
+		if strings.HasPrefix(line, name+" ") {
+			return strings.TrimPrefix(line, name+" "), true
+		}
+	}
+	return "", false
+}
+
+// object reads the object id from the loose object store or the packs and
+// returns its type and contents.
+func (r *gitRepo) object(id string) (string, []byte, error) {
+	typ, data, err := r.looseObject(id)
+	if err != errObjectNotFound {
+		return typ, data, err
+	}
+	raw, err := hex.DecodeString(id)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid object name %q", id)
+	}
+	packs, err := r.loadPacks()
+	if err != nil {
+		return "", nil, err
+	}
+	for _, p := range packs {
+		if off, ok := p.find(raw); ok {
+			return p.read(r, off)
+		}
+	}
+	return "", nil, errObjectNotFound
+}
+
+// looseObject reads the zlib-compressed object file for id.
+func (r *gitRepo) looseObject(id string) (string, []byte, error) {
+	if len(id) < 3 {
+		return "", nil, errObjectNotFound
+	}
+	f, err := os.Open(filepath.Join(r.commonDir, "objects", id[:2], id[2:]))
+	if os.IsNotExist(err) {
+		return "", nil, errObjectNotFound
+	} else if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	zr, err := zlib.NewReader(f)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read object %s: %v", id, err)
+	}
+	defer zr.Close()
+	b, err := ioutil.ReadAll(zr)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read object %s: %v", id, err)
+	}
+	i := bytes.IndexByte(b, 0)
+	if i == -1 {
+		return "", nil, fmt.Errorf("malformed object %s", id)
+	}
+	hdr := strings.Fields(string(b[:i]))
+	if len(hdr) != 2 {
+		return "", nil, fmt.Errorf("malformed object header %s", id)
+	}
+	return hdr[0], b[i+1:], nil
+}
+
+// loadPacks reads the indexes of all packs in the repository.
+func (r *gitRepo) loadPacks() ([]*gitPack, error) {
+	if r.packs != nil {
+		return r.packs, nil
+	}
+	r.packs = []*gitPack{}
+	idxs, err := filepath.Glob(filepath.Join(r.commonDir, "objects", "pack", "*.idx"))
+	if err != nil {
+		return nil, err
+	}
+	for _, idx := range idxs {
+		p, err := openPackIndex(idx)
+		if err != nil {
+			return nil, err
+		}
+		r.packs = append(r.packs, p)
+	}
+	return r.packs, nil
+}
+
+// pack object types
+const (
+	packCommit   = 1
+	packTree     = 2
+	packBlob     = 3
+	packTag      = 4
+	packOfsDelta = 6
+	packRefDelta = 7
+)
+
+var packTypeNames = map[byte]string{
+	packCommit: "commit",
+	packTree:   "tree",
+	packBlob:   "blob",
+	packTag:    "tag",
+}
+
+// gitPack is a packfile along with its version 2 index.
+type gitPack struct {
+	path    string   // path of the .pack file
+	hashLen int      // length of object names in bytes
+	fanout  []uint32 // cumulative object counts by first byte of the name
+	names   []byte   // sorted object names
+	offsets []byte   // 4-byte offsets into the pack
+	large   []byte   // 8-byte offsets for packs larger than 2GiB
+}
+
+// openPackIndex reads a version 2 pack index file.
+func openPackIndex(path string) (*gitPack, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	const hdrLen = 8 + 256*4
+	if len(b) < hdrLen || !bytes.Equal(b[:4], []byte("\377tOc")) || binary.BigEndian.Uint32(b[4:8]) != 2 {
+		return nil, fmt.Errorf("unsupported pack index %s", path)
+	}
+	p := &gitPack{path: strings.TrimSuffix(path, ".idx") + ".pack", fanout: make([]uint32, 256)}
+	for i := range p.fanout {
+		p.fanout[i] = binary.BigEndian.Uint32(b[8+i*4:])
+	}
+	n := int(p.fanout[255])
+
+	// the index ends with two checksums of the same size as object names:
+	// hdr + n*(hashLen + crc + offset) + large offsets + 2*hashLen
+	for _, hashLen := range []int{20, 32} {
+		rest := len(b) - hdrLen - n*(hashLen+8) - 2*hashLen
+		if rest >= 0 && rest%8 == 0 {
+			p.hashLen = hashLen
+			break
+		}
+	}
+	if p.hashLen == 0 {
+		return nil, fmt.Errorf("malformed pack index %s", path)
+	}
+	names := hdrLen
+	offsets := names + n*p.hashLen + n*4
+	large := offsets + n*4
+	p.names = b[names : names+n*p.hashLen]
+	p.offsets = b[offsets:large]
+	p.large = b[large : len(b)-2*p.hashLen]
+	return p, nil
+}
+
+// find returns the offset of the object in the pack.
+func (p *gitPack) find(id []byte) (int64, bool) {
+	if len(id) != p.hashLen {
+		return 0, false
+	}
+	lo := 0
+	if id[0] > 0 {
+		lo = int(p.fanout[id[0]-1])
+	}
+	hi := int(p.fanout[id[0]])
+	i := lo + sort.Search(hi-lo, func(i int) bool {
+		return bytes.Compare(p.names[(lo+i)*p.hashLen:(lo+i+1)*p.hashLen], id) >= 0
+	})
+	if i >= hi || !bytes.Equal(p.names[i*p.hashLen:(i+1)*p.hashLen], id) {
+		return 0, false
+	}
+	off := binary.BigEndian.Uint32(p.offsets[i*4:])
+	if off&0x80000000 == 0 {
+		return int64(off), true
+	}
+	j := int(off&0x7fffffff) * 8
+	if j+8 > len(p.large) {
+		return 0, false
+	}
+	return int64(binary.BigEndian.Uint64(p.large[j:])), true
+}
+
+// read returns the type and contents of the object at offset, resolving
+// deltas against their base objects.
+func (p *gitPack) read(r *gitRepo, offset int64) (string, []byte, error) {
+	f, err := os.Open(p.path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	return p.readAt(r, f, offset, 0)
+}
+
+func (p *gitPack) readAt(r *gitRepo, f *os.File, offset int64, depth int) (string, []byte, error) {
+	if depth > 50 {
+		return "", nil, fmt.Errorf("delta chain too long in %s", p.path)
+	}
+	br := bufio.NewReader(io.NewSectionReader(f, offset, 1<<62))
+	c, err := br.ReadByte()
+	if err != nil {
+		return "", nil, err
+	}
+	typ := (c >> 4) & 7
+	size := uint64(c & 0x0f)
+	for shift := uint(4); c&0x80 != 0; shift += 7 {
+		if c, err = br.ReadByte(); err != nil {
+			return "", nil, err
+		}
+		size |= uint64(c&0x7f) << shift
+	}
+
+	var baseType string
+	var base []byte
+	switch typ {
+	case packOfsDelta:
+		c, err := br.ReadByte()
+		if err != nil {
+			return "", nil, err
+		}
+		rel := int64(c & 0x7f)
+		for c&0x80 != 0 {
+			if c, err = br.ReadByte(); err != nil {
+				return "", nil, err
+			}
+			rel = ((rel + 1) << 7) | int64(c&0x7f)
+		}
+		if baseType, base, err = p.readAt(r, f, offset-rel, depth+1); err != nil {
+			return "", nil, err
+		}
+	case packRefDelta:
+		id := make([]byte, p.hashLen)
+		if _, err := io.ReadFull(br, id); err != nil {
+			return "", nil, err
+		}
+		if baseType, base, err = r.object(hex.EncodeToString(id)); err != nil {
+			return "", nil, err
+		}
+	default:
+		if _, ok := packTypeNames[typ]; !ok {
+			return "", nil, fmt.Errorf("unknown object type %d in %s", typ, p.path)
+		}
+	}
+
+	zr, err := zlib.NewReader(br)
+	if err != nil {
+		return "", nil, err
+	}
+	defer zr.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(zr, int64(size)))
+	if err != nil {
+		return "", nil, err
+	}
+	if base == nil {
+		return packTypeNames[typ], data, nil
+	}
+	out, err := applyDelta(base, data)
+	return baseType, out, err
+}
+
+// applyDelta reconstructs an object from its base and a git delta.
+func applyDelta(base, delta []byte) ([]byte, error) {
+	errMalformed := errors.New("malformed delta")
+	varint := func() (uint64, error) {
+		var v uint64
+		for shift := uint(0); ; shift += 7 {
+			if len(delta) == 0 {
+				return 0, errMalformed
+			}
+			c := delta[0]
+			delta = delta[1:]
+			v |= uint64(c&0x7f) << shift
+			if c&0x80 == 0 {
+				return v, nil
+			}
+		}
+	}
+	srcSize, err := varint()
+	if err != nil {
+		return nil, err
+	}
+	if srcSize != uint64(len(base)) {
+		return nil, fmt.Errorf("delta base size mismatch: %d != %d", srcSize, len(base))
+	}
+	dstSize, err := varint()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, dstSize)
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+		switch {
+		case op&0x80 != 0: // copy from base
+			var off, n uint64
+			for i := uint(0); i < 7; i++ {
+				if op&(1<<i) == 0 {
+					continue
+				}
+				if len(delta) == 0 {
+					return nil, errMalformed
+				}
+				if i < 4 {
+					off |= uint64(delta[0]) << (8 * i)
+				} else {
+					n |= uint64(delta[0]) << (8 * (i - 4))
+				}
+				delta = delta[1:]
+			}
+			if n == 0 {
+				n = 0x10000
+			}
+			if off+n > uint64(len(base)) {
+				return nil, errMalformed
+			}
+			out = append(out, base[off:off+n]...)
+		case op != 0: // insert literal data
+			if int(op) > len(delta) {
+				return nil, errMalformed
+			}
+			out = append(out, delta[:op]...)
+			delta = delta[op:]
+		default:
+			return nil, errMalformed
+		}
+	}
+	if uint64(len(out)) != dstSize {
+		return nil, errMalformed
+	}
+	return out, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// requireNativeMatchesGit checks gitNative reports the same values as the git
+// binary for dir.
+func requireNativeMatchesGit(t *testing.T, dir string) {
+	repo, native := git{dir}, gitNative{dir}
+
+	c1, err := repo.Commit()
+	require.Nil(t, err)
+	c2, err := native.Commit()
+	require.Nil(t, err)
+	require.Equal(t, c1, c2, "commit")
+
+	require.Equal(t, repo.Branch(), native.Branch(), "branch")
+
+	s1, err := repo.exec("describe", "--tags", "--always")
+	require.Nil(t, err)
+	s2, err := native.Summary()
+	require.Nil(t, err)
+	require.Equal(t, s1, s2, "summary")
+
+	d1, err := repo.CommitDate()
+	require.Nil(t, err)
+	d2, err := native.CommitDate()
+	require.Nil(t, err)
+	require.Equal(t, d1, d2, "commit date")
+}
+
+func TestGitNative(t *testing.T) {
+	repo := newRepo(t)
+	defer os.RemoveAll(repo.dir)
+	native := gitNative{repo.dir}
+
+	_, err := native.Commit()
+	require.NotNil(t, err, "empty repository has no commits")
+
+	state, err := native.State()
+	require.Nil(t, err)
+	require.Equal(t, "unknown", state)
+
+	// untagged
+	mkCommit(t, repo, "commit 1")
+	requireNativeMatchesGit(t, repo.dir)
+
+	// lightweight tag
+	_, err = repo.exec("tag", "v1.0.0")
+	require.Nil(t, err)
+	requireNativeMatchesGit(t, repo.dir)
+
+	// annotated tag with commits on top, including a merge
+	mkCommit(t, repo, "commit 2")
+	_, err = repo.exec("tag", "-a", "v1.1.0", "-m", "release")
+	require.Nil(t, err)
+	_, err = repo.exec("checkout", "-q", "-b", "feature")
+	require.Nil(t, err)
+	mkCommit(t, repo, "commit 3")
+	mkCommit(t, repo, "commit 4")
+	_, err = repo.exec("checkout", "-q", "master")
+	require.Nil(t, err)
+	mkCommit(t, repo, "commit 5")
+	_, err = repo.exec("merge", "-q", "--no-edit", "feature")
+	require.Nil(t, err)
+	requireNativeMatchesGit(t, repo.dir)
+
+	// from a subdirectory
+	sub := filepath.Join(repo.dir, "sub")
+	require.Nil(t, os.Mkdir(sub, 0755))
+	requireNativeMatchesGit(t, sub)
+
+	// packed refs and objects
+	_, err = repo.exec("gc", "-q", "--aggressive")
+	require.Nil(t, err)
+	requireNativeMatchesGit(t, repo.dir)
+
+	// detached
+	_, err = repo.exec("checkout", "-q", "HEAD~1")
+	require.Nil(t, err)
+	requireNativeMatchesGit(t, repo.dir)
+	require.Equal(t, "HEAD", native.Branch())
+
+	// linked worktree with a .git file
+	wt := filepath.Join(repo.dir, "wt")
+	_, err = repo.exec("worktree", "add", "-q", "-b", "wt-branch", wt, "feature")
+	require.Nil(t, err)
+	fi, err := os.Stat(filepath.Join(wt, ".git"))
+	require.Nil(t, err)
+	require.False(t, fi.IsDir())
+	requireNativeMatchesGit(t, wt)
+	require.Equal(t, "wt-branch", gitNative{wt}.Branch())
+}
+
+func Test_applyDelta(t *testing.T) {
+	base := []byte("hello, world")
+	delta := []byte{
+		12, 13, // source and target sizes
+		0x80 | 0x10 | 0x01, 0, 7, // copy 7 bytes from offset 0: "hello, "
+		6, 'g', 'o', 'p', 'h', 'e', 'r', // insert "gopher"
+	}
+	out, err := applyDelta(base, delta)
+	require.Nil(t, err)
+	require.Equal(t, "hello, gopher", string(out))
+
+	_, err = applyDelta(base, []byte{5, 5})
+	require.NotNil(t, err, "base size mismatch")
+
+	_, err = applyDelta(base, []byte{12, 1, 0x80 | 0x10 | 0x01, 10, 5})
+	require.NotNil(t, err, "copy out of bounds")
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// flChdir is the go tool's -C flag, which changes to a directory before
+// running the command. It must come before the subcommand.
+const flChdir = "-C"
+
+// goCommand describes a go tool command line.
+type goCommand struct {
+	args   []string // the command line, without the program name
+	subcmd int      // index of the subcommand in args, or -1
+	dir    string   // directory given with -C, or ""
+}
+
+// parseGoCommand locates the subcommand in a go tool command line (without the
+// program name), skipping the global flags and govvv directives before it.
+func parseGoCommand(args []string) goCommand {
+	cmd := goCommand{args: args, subcmd: -1}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if hasArgument, ok := govvvDirectives[arg]; ok {
+			if hasArgument {
+				i++
+			}
+			continue
+		}
+		if !strings.HasPrefix(arg, "-") {
+			cmd.subcmd = i
+			break
+		}
+		name, value, hasValue := arg, "", false
+		if j := strings.Index(arg, "="); j != -1 {
+			name, value, hasValue = arg[:j], arg[j+1:], true
+		}
+		if name != flChdir && name != "-"+flChdir {
+			continue // the go tool reports unknown flags
+		}
+		if !hasValue && i+1 < len(args) {
+			i++
+			value = args[i]
+		}
+		cmd.dir = value
+	}
+	return cmd
+}
+
+// goFlagsWithValue are the flags of the go build, install, run and test
+// commands (including the test binary flags go test accepts) that take a
+// value as a separate argument. Other flags are booleans, or must be given a
+// value with "=".
+var goFlagsWithValue = map[string]bool{
+	"C": true, "p": true, "o": true, "exec": true,
+	"asmflags": true, "buildmode": true, "compiler": true, "gccgoflags": true,
+	"gcflags": true, "installsuffix": true, "ldflags": true, "mod": true,
+	"modfile": true, "overlay": true, "pgo": true, "pkgdir": true, "tags": true,
+	"toolexec": true, "covermode": true, "coverpkg": true,
+	// go test
+	"bench": true, "benchtime": true, "blockprofile": true,
+	"blockprofilerate": true, "count": true, "coverprofile": true, "cpu": true,
+	"cpuprofile": true, "fuzz": true, "fuzzminimizetime": true, "fuzztime": true,
+	"list": true, "memprofile": true, "memprofilerate": true,
+	"mutexprofile": true, "mutexprofilefraction": true, "outputdir": true,
+	"parallel": true, "run": true, "shuffle": true, "skip": true,
+	"timeout": true, "trace": true, "vet": true,
+}
+
+// takesValue returns true if the flag arg is given its value as the next
+// argument.
+func takesValue(arg string) bool {
+	if strings.Contains(arg, "=") {
+		return false
+	}
+	name := strings.TrimLeft(arg, "-")
+	return goFlagsWithValue[strings.TrimPrefix(name, "test.")]
+}
+
+// positionals returns the indices of the arguments after the subcommand that
+// are not flags or flag values, up to the end of the go tool's arguments.
+func (c goCommand) positionals() []int {
+	if c.subcmd == -1 {
+		return nil
+	}
+	var out []int
+	for i, end := c.subcmd+1, c.flagsEnd(); i < end; i++ {
+		arg := c.args[i]
+		if hasArgument, ok := govvvDirectives[arg]; ok {
+			if hasArgument {
+				i++
+			}
+		} else if !strings.HasPrefix(arg, "-") || arg == "-" {
+			out = append(out, i)
+		} else if takesValue(arg) {
+			i++
+		}
+	}
+	return out
+}
+
+// flagsEnd returns the index of the first argument that is not meant for the
+// go tool: the program arguments of go run, which follow the package (or the
+// .go files), and the test binary arguments after -args in go test.
+func (c goCommand) flagsEnd() int {
+	switch c.subcommand() {
+	case "run":
+		files := false
+		for i := c.subcmd + 1; i < len(c.args); i++ {
+			arg := c.args[i]
+			if hasArgument, ok := govvvDirectives[arg]; ok {
+				if hasArgument {
+					i++
+				}
+			} else if !strings.HasPrefix(arg, "-") {
+				if !strings.HasSuffix(arg, ".go") {
+					if files {
+						return i
+					}
+					return i + 1
+				}
+				files = true
+			} else if files {
+				return i
+			} else if takesValue(arg) {
+				i++
+			}
+		}
+	case "test":
+		for i := c.subcmd + 1; i < len(c.args); i++ {
+			if arg := c.args[i]; arg == "-args" || arg == "--args" {
+				return i
+			}
+		}
+	}
+	return len(c.args)
+}
+
+// flagValue returns the value of the last occurrence of the go tool flag name
+// (e.g. "-o") after the subcommand.
+func (c goCommand) flagValue(name string) (value string, ok bool) {
+	if c.subcmd == -1 {
+		return "", false
+	}
+	name = strings.TrimLeft(name, "-")
+	for i, end := c.subcmd+1, c.flagsEnd(); i < end; i++ {
+		arg := c.args[i]
+		if hasArgument, isDirective := govvvDirectives[arg]; isDirective {
+			if hasArgument {
+				i++
+			}
+			continue
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		n, v, hasValue := strings.TrimLeft(arg, "-"), "", false
+		if j := strings.Index(n, "="); j != -1 {
+			n, v, hasValue = n[:j], n[j+1:], true
+		}
+		if !hasValue && takesValue(arg) && i+1 < end {
+			i++
+			v = c.args[i]
+		}
+		if n == name {
+			value, ok = v, true
+		}
+	}
+	return value, ok
+}
+
+// goListFlags are the build flags that change the files of the packages, which
+// "go list" must be given to list the packages that are built.
+var goListFlags = []string{"-tags", "-mod", "-modfile", "-overlay"}
+
+// listFlags returns the build flags on the command line that "go list" needs
+// to see the packages as they are built.
+func (c goCommand) listFlags() []string {
+	var out []string
+	for _, name := range goListFlags {
+		if value, ok := c.flagValue(name); ok {
+			out = append(out, name+"="+value)
+		}
+	}
+	return out
+}
+
+// packages returns the packages (or files) named on the command line.
+func (c goCommand) packages() []string {
+	var out []string
+	for _, i := range c.positionals() {
+		out = append(out, c.args[i])
+	}
+	return out
+}
+
+// injectsLdFlags returns true if govvv adds -ldflags to the go subcommand.
+func injectsLdFlags(subcommand string) bool {
+	switch subcommand {
+	case "build", "install", "run", "test":
+		return true
+	}
+	return false
+}
+
+// mainPackages returns the import paths of the main packages among pkgs, as
+// reported by "go list" in dir with the build flags.
+func mainPackages(dir string, flags, pkgs []string) ([]string, error) {
+	args := append([]string{"list", "-e", "-f", `{{if eq .Name "main"}}{{.ImportPath}}{{end}}`}, flags...)
+	out, err := execIn(dir, "go", append(args, pkgs...)...)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(out), nil
+}
+
+// versionPackage is the import path of the package govvv sets the variables
+// of, in addition to the main package, when the build imports it and -pkg is
+// not given.
+const versionPackage = "github.com/ahmetb/govvv/version"
+
+// importsPackage reports whether pkgs, or their tests if tests is true,
+// depend on the package path, as reported by "go list -deps" in dir with the
+// build flags.
+func importsPackage(dir string, flags, pkgs []string, tests bool, path string) (bool, error) {
+	args := append([]string{"list", "-deps", "-f", "{{.ImportPath}}"}, flags...)
+	if tests {
+		args = append(args, "-test")
+	}
+	out, err := execIn(dir, "go", append(args, pkgs...)...)
+	if err != nil {
+		return false, err
+	}
+	for _, p := range strings.Fields(out) {
+		if p == path {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// addImportPathKeys returns a copy of values where every "main." key is also
+// set for each of the given main package import paths. When testing a main
+// package, the go tool links it into the test binary under its import path,
+// so "-X main.Name=value" does not apply to it.
+func addImportPathKeys(values map[string]string, paths []string) map[string]string {
+	out := make(map[string]string, len(values)*(len(paths)+1))
+	for k, v := range values {
+		out[k] = v
+	}
+	for k, v := range values {
+		if !strings.HasPrefix(k, defaultPackage+".") {
+			continue
+		}
+		for _, p := range paths {
+			out[p+strings.TrimPrefix(k, defaultPackage)] = v
+		}
+	}
+	return out
+}
+
+// subcommand returns the go tool subcommand, or "" if there is none.
+func (c goCommand) subcommand() string {
+	if c.subcmd == -1 {
+		return ""
+	}
+	return c.args[c.subcmd]
+}
+
+// workDir returns the directory the go tool runs the command in, given the
+// current working directory wd.
+func (c goCommand) workDir(wd string) string {
+	if c.dir == "" {
+		return wd
+	}
+	if filepath.IsAbs(c.dir) {
+		return c.dir
+	}
+	return filepath.Join(wd, c.dir)
+}
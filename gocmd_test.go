@@ -0,0 +1,98 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseGoCommand(t *testing.T) {
+	cases := []struct {
+		in     []string
+		sub    string
+		subcmd int
+		dir    string
+	}{
+		{[]string{}, "", -1, ""},
+		{[]string{"build", "."}, "build", 0, ""},
+		{[]string{"-C", "./service", "build", "-C", "x"}, "build", 2, "./service"},
+		{[]string{"-C=../x", "install"}, "install", 1, "../x"},
+		{[]string{"--C", "build", "list"}, "list", 2, "build"},
+		{[]string{"-print", "-pkg", "main", "-C", "d", "build"}, "build", 5, "d"},
+		{[]string{"-version", "build", "list"}, "list", 2, ""},
+		{[]string{"-v", "build"}, "build", 1, ""},
+		{[]string{"-flags"}, "", -1, ""},
+	}
+	for _, c := range cases {
+		cmd := parseGoCommand(c.in)
+		require.Equal(t, c.sub, cmd.subcommand(), "input args=%#v", c.in)
+		require.Equal(t, c.subcmd, cmd.subcmd, "input args=%#v", c.in)
+		require.Equal(t, c.dir, cmd.dir, "input args=%#v", c.in)
+	}
+}
+
+func Test_goCommand_workDir(t *testing.T) {
+	require.Equal(t, "/wd", goCommand{}.workDir("/wd"))
+	require.Equal(t, "/wd/service", goCommand{dir: "./service"}.workDir("/wd"))
+	require.Equal(t, "/x", goCommand{dir: "../x"}.workDir("/wd"))
+	require.Equal(t, "/abs", goCommand{dir: "/abs"}.workDir("/wd"))
+}
+
+func Test_goCommand_flagsEnd(t *testing.T) {
+	cases := []struct {
+		in       []string
+		end      int
+		packages []string
+	}{
+		{[]string{"build", "-o", "out", "."}, 4, []string{"."}},
+		{[]string{"run", "-tags", "x", ".", "-ldflags", "y"}, 4, []string{"."}},
+		{[]string{"run", "-exec=echo", "main.go", "util.go", "-v", "arg"}, 4, []string{"main.go", "util.go"}},
+		{[]string{"run", "-print", "./cmd/api", "serve"}, 3, []string{"./cmd/api"}},
+		{[]string{"test", "-run", "TestX", "./...", "-v", "-args", "-ldflags"}, 5, []string{"./..."}},
+		{[]string{"test", "-c", "-o", "x.test", "-test.count", "2", "."}, 7, []string{"."}},
+		{[]string{"-C", "dir", "test"}, 3, nil},
+	}
+	for _, c := range cases {
+		cmd := parseGoCommand(c.in)
+		require.Equal(t, c.end, cmd.flagsEnd(), "input args=%#v", c.in)
+		require.Equal(t, c.packages, cmd.packages(), "input args=%#v", c.in)
+	}
+}
+
+func Test_addImportPathKeys(t *testing.T) {
+	values := map[string]string{
+		"main.Version":         "1.0",
+		"example.com/v.Commit": "abc",
+	}
+	out := addImportPathKeys(values, []string{"example.com/cmd/a", "example.com/cmd/b"})
+	require.Equal(t, map[string]string{
+		"main.Version":              "1.0",
+		"example.com/cmd/a.Version": "1.0",
+		"example.com/cmd/b.Version": "1.0",
+		"example.com/v.Commit":      "abc",
+	}, out)
+	require.Len(t, values, 2)
+	require.Equal(t, values, addImportPathKeys(values, nil))
+}
+
+func Test_goCommand_flagValue(t *testing.T) {
+	cmd := parseGoCommand([]string{"-C", "d", "build", "-v", "-o", "out", "-tags=x", "--o=out2", "-print", "."})
+	v, ok := cmd.flagValue("-o")
+	require.True(t, ok)
+	require.Equal(t, "out2", v)
+	v, ok = cmd.flagValue("tags")
+	require.True(t, ok)
+	require.Equal(t, "x", v)
+	_, ok = cmd.flagValue("-C")
+	require.False(t, ok)
+
+	// not in the program arguments
+	_, ok = parseGoCommand([]string{"run", ".", "-o", "x"}).flagValue("-o")
+	require.False(t, ok)
+}
+
+func Test_goCommand_listFlags(t *testing.T) {
+	cmd := parseGoCommand([]string{"build", "-v", "-tags", "prod", "-mod=vendor", "-o", "out", "-print", "."})
+	require.Equal(t, []string{"-tags=prod", "-mod=vendor"}, cmd.listFlags())
+	require.Empty(t, parseGoCommand([]string{"build", "."}).listFlags())
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// goFile is the data Go source files are rendered from.
+type goFile struct {
+	Package string            // package name
+	Values  map[string]string // values by variable name, e.g. "GitCommit"
+	Strings []goConst         // string constants, sorted by name
+
+	// BuildUnix is the build time as a unix timestamp, if HasBuildUnix.
+	BuildUnix    int64
+	HasBuildUnix bool
+
+	// GitDirty reports whether the working copy has changes, if HasGitState.
+	GitDirty    bool
+	HasGitState bool
+}
+
+// goConst is a string constant in a generated Go file.
+type goConst struct {
+	Name, Value string
+}
+
+// defaultGoFileTemplate renders the values as typed constants.
+var defaultGoFileTemplate = template.Must(template.New("gofile").Parse(`// Code generated by govvv. DO NOT EDIT.
+
+package {{.Package}}
+{{if .HasBuildUnix}}
+import "time"
+{{end}}
+// Build information.
+const (
+{{- range .Strings}}
+	{{.Name}} = {{printf "%q" .Value}}
+{{- end}}
+{{- if .HasBuildUnix}}
+	BuildUnix int64 = {{.BuildUnix}}
+{{- end}}
+{{- if .HasGitState}}
+	GitDirty = {{.GitDirty}}
+{{- end}}
+)
+{{if .HasBuildUnix}}
+// BuildTime is the time of the build.
+var BuildTime = time.Unix(BuildUnix, 0).UTC()
+{{end}}`))
+
+// newGoFile returns the data to render a Go file of package pkg from values,
+// which are keyed by "pkg.Name" as with -X. The constants are named after the
+// variables, so keys of different packages with the same name must have the
+// same value.
+func newGoFile(pkg string, values map[string]string) (goFile, error) {
+	f := goFile{Package: pkg, Values: make(map[string]string)}
+	keys := make(map[string]string)
+	for k, v := range values {
+		name := k[strings.LastIndex(k, ".")+1:]
+		if other, ok := keys[name]; ok && f.Values[name] != v {
+			if other > k {
+				other, k = k, other
+			}
+			return f, fmt.Errorf("%s and %s have different values, they cannot both be constant %s", other, k, name)
+		}
+		keys[name], f.Values[name] = k, v
+	}
+	for name, v := range f.Values {
+		switch name {
+		case varBuildUnix:
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return f, fmt.Errorf("%s=%q is not a unix time", name, v)
+			}
+			f.BuildUnix, f.HasBuildUnix = n, true
+			continue
+		case "GitState":
+			f.GitDirty, f.HasGitState = v == "dirty", true
+		}
+		f.Strings = append(f.Strings, goConst{name, v})
+	}
+	sort.Slice(f.Strings, func(i, j int) bool { return f.Strings[i].Name < f.Strings[j].Name })
+	return f, nil
+}
+
+// renderGoFile executes tmpl with f and formats the result as Go source.
+func renderGoFile(tmpl *template.Template, f goFile) ([]byte, error) {
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, f); err != nil {
+		return nil, fmt.Errorf("failed to render Go file: %v", err)
+	}
+	out, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("rendered Go file is invalid: %v", err)
+	}
+	return out, nil
+}
+
+// goPackageName returns the package name declared in the Go source file fp.
+func goPackageName(fp string) (string, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), fp, nil, parser.PackageClauseOnly)
+	if err != nil {
+		return "", err
+	}
+	return f.Name.Name, nil
+}
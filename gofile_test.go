@@ -0,0 +1,73 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var goFileValues = map[string]string{
+	"main.GitCommit":  "0b5ed7a",
+	"main.GitBranch":  "master",
+	"main.GitState":   "dirty",
+	"main.GitSummary": "v1.0.0-1-g0b5ed7a-dirty",
+	"main.BuildDate":  "2017-07-14T02:40:00Z",
+	"main.BuildUnix":  "1500000000",
+	"main.Version":    `1.0.0 "beta"`,
+}
+
+func Test_renderGoFile(t *testing.T) {
+	f, err := newGoFile("version", goFileValues)
+	require.Nil(t, err)
+	require.True(t, f.GitDirty)
+	require.EqualValues(t, 1500000000, f.BuildUnix)
+	require.Equal(t, "0b5ed7a", f.Values["GitCommit"])
+
+	out, err := renderGoFile(defaultGoFileTemplate, f)
+	require.Nil(t, err)
+	requireGolden(t, "gofile-default", string(out))
+
+	// only strings
+	f, err = newGoFile("main", map[string]string{"main.Version": "1.0"})
+	require.Nil(t, err)
+	out, err = renderGoFile(defaultGoFileTemplate, f)
+	require.Nil(t, err)
+	require.NotContains(t, string(out), "time")
+	require.Contains(t, string(out), `Version = "1.0"`)
+}
+
+func Test_newGoFile_packages(t *testing.T) {
+	// the same value for different packages
+	f, err := newGoFile("version", map[string]string{
+		"main.Version": "1.0", "github.com/ahmetb/govvv/version.Version": "1.0"})
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{"Version": "1.0"}, f.Values)
+
+	_, err = newGoFile("version", map[string]string{
+		"main.Version": "1.0", "github.com/ahmetb/govvv/version.Version": "2.0"})
+	require.EqualError(t, err, "github.com/ahmetb/govvv/version.Version and main.Version have different values, "+
+		"they cannot both be constant Version")
+}
+
+func Test_newGoFile_badBuildUnix(t *testing.T) {
+	_, err := newGoFile("main", map[string]string{"main.BuildUnix": "yesterday"})
+	require.EqualError(t, err, `BuildUnix="yesterday" is not a unix time`)
+}
+
+func Test_goPackageName(t *testing.T) {
+	dir, err := ioutil.TempDir("", "govvv-test")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	fp := filepath.Join(dir, "a.go")
+	require.Nil(t, ioutil.WriteFile(fp, []byte("// Package foo.\npackage foo\n\nvar x = 1\n"), 0644))
+	name, err := goPackageName(fp)
+	require.Nil(t, err)
+	require.Equal(t, "foo", name)
+
+	_, err = goPackageName(filepath.Join(dir, "missing.go"))
+	require.NotNil(t, err)
+}
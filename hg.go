@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type hg struct {
+	dir string
+}
+
+func (h hg) exec(args ...string) (string, error) {
+	return execIn(h.dir, "hg", args...)
+}
+
+// Commit returns the short changeset hash of the working directory's parent.
+func (h hg) Commit() (string, error) {
+	out, err := h.exec("id", "-i")
+	if err != nil {
+		return "", err
+	}
+	// "hg id" marks uncommitted changes with a trailing "+".
+	return strings.TrimSuffix(out, "+"), nil
+}
+
+// State returns the repository state indicating whether
+// it is "clean" or "dirty".
+func (h hg) State() (string, error) {
+	out, err := h.exec("status")
+	if err != nil {
+		return "", err
+	}
+	if len(out) > 0 {
+		return "dirty", nil
+	}
+	return "clean", nil
+}
+
+// Branch returns the named branch of the working directory. If an error
+// occurs, returns "HEAD".
+func (h hg) Branch() string {
+	out, err := h.exec("branch")
+	if err != nil {
+		return "HEAD"
+	}
+	return out
+}
+
+// Summary returns a "git describe --tags --dirty --always" equivalent built
+// from the latest tag and the distance to it.
+func (h hg) Summary() (string, error) {
+	out, err := h.exec("log", "-r", ".", "--template", `{latesttag}\n{latesttagdistance}\n{node|short}`)
+	if err != nil {
+		return "", err
+	}
+	s, err := hgSummary(out)
+	if err != nil {
+		return "", err
+	}
+	state, err := h.State()
+	if err != nil {
+		return "", err
+	}
+	if state == "dirty" {
+		s += "-dirty"
+	}
+	return s, nil
+}
+
+// CommitDate returns the commit date of the working directory's parent.
+func (h hg) CommitDate() (time.Time, error) {
+	out, err := h.exec("log", "-r", ".", "--template", "{date|hgdate}")
+	if err != nil {
+		return time.Time{}, err
+	}
+	return hgDate(out)
+}
+
+// hgDate parses the output of the hgdate template, "<unix seconds> <timezone
+// offset>".
+func hgDate(out string) (time.Time, error) {
+	f := strings.Fields(out)
+	if len(f) == 0 {
+		return time.Time{}, fmt.Errorf("hg: unexpected log output: %q", out)
+	}
+	return parseUnixTime(f[0])
+}
+
+// hgSummary formats the output of the latesttag, latesttagdistance and
+// node|short templates (one per line) like "git describe --tags --always".
+func hgSummary(out string) (string, error) {
+	f := strings.Split(out, "\n")
+	if len(f) != 3 {
+		return "", fmt.Errorf("hg: unexpected log output: %q", out)
+	}
+	tag, distance, node := f[0], f[1], f[2]
+	switch {
+	case tag == "" || tag == "null":
+		return node, nil
+	case distance == "0":
+		return tag, nil
+	default:
+		return fmt.Sprintf("%s-%s-%s", tag, distance, node), nil
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_hgSummary(t *testing.T) {
+	cases := []struct {
+		in, out string
+	}{
+		{"null\n1\n0b5ed7a1c2d3", "0b5ed7a1c2d3"},
+		{"v1.0.0\n0\n0b5ed7a1c2d3", "v1.0.0"},
+		{"v1.0.0\n2\n0b5ed7a1c2d3", "v1.0.0-2-0b5ed7a1c2d3"},
+		{"v1.0.0-rc.1\n5\n0b5ed7a1c2d3", "v1.0.0-rc.1-5-0b5ed7a1c2d3"},
+	}
+	for _, c := range cases {
+		out, err := hgSummary(c.in)
+		require.Nil(t, err)
+		require.Equal(t, c.out, out, "input=%q", c.in)
+	}
+
+	_, err := hgSummary("garbage")
+	require.NotNil(t, err)
+}
+
+func Test_hgDate(t *testing.T) {
+	v, err := hgDate("1500000000 -7200")
+	require.Nil(t, err)
+	require.Equal(t, int64(1500000000), v.Unix())
+
+	for _, in := range []string{"", " \n", "garbage 0"} {
+		_, err := hgDate(in)
+		require.NotNil(t, err, "input=%q", in)
+	}
+}
+
+func TestHg(t *testing.T) {
+	if _, err := exec.LookPath("hg"); err != nil {
+		t.Skip("hg is not installed")
+	}
+	dir := tmpDir(t)
+	defer os.RemoveAll(dir)
+
+	repo := hg{dir}
+	_, err := repo.exec("init")
+	require.Nil(t, err, "failed to initialize hg repo")
+	require.IsType(t, hg{}, detectVCS(dir))
+
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "a"), []byte("a"), 0600))
+	_, err = repo.exec("commit", "-A", "-u", "test", "-m", "commit 1")
+	require.Nil(t, err)
+
+	c, err := repo.Commit()
+	require.Nil(t, err)
+	require.Regexp(t, "^[0-9a-f]{12}$", c)
+	require.Equal(t, "default", repo.Branch())
+
+	s, err := repo.State()
+	require.Nil(t, err)
+	require.Equal(t, "clean", s)
+
+	sum, err := repo.Summary()
+	require.Nil(t, err)
+	require.Equal(t, c, sum)
+
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "b"), []byte("b"), 0600))
+	s, err = repo.State()
+	require.Nil(t, err)
+	require.Equal(t, "dirty", s)
+
+	sum, err = repo.Summary()
+	require.Nil(t, err)
+	require.Equal(t, c+"-dirty", sum)
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"debug/buildinfo"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// sources of inspected values
+const (
+	inspectSourceLdFlags = "ldflags" // the -ldflags build setting
+	inspectSourceSymbols = "symbols" // the symbol table
+)
+
+// inspectVars are the names of the variables govvv sets, which are looked up
+// in the symbol table when the -ldflags build setting is not recorded.
+var inspectVars = map[string]bool{
+	"GitCommit": true, "GitBranch": true, "GitState": true, "GitSummary": true,
+	"BuildDate": true, "BuildUnix": true, "CommitDate": true, "ChangeID": true,
+	"Version": true,
+}
+
+// maxInspectedString is the length above which a string read from the symbol
+// table is assumed to be something else.
+const maxInspectedString = 1 << 16
+
+// inspectResult is what "govvv inspect" reports about a binary.
+type inspectResult struct {
+	Path      string         `json:"path"`
+	GoVersion string         `json:"goVersion,omitempty"`
+	Main      string         `json:"main,omitempty"`
+	Values    []inspectValue `json:"values"`
+}
+
+// inspectValue is an -X flag found in a binary.
+type inspectValue struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// runInspect implements "govvv inspect [-json] <binary>".
+func runInspect(w io.Writer, args []string) error {
+	cmd := parseGoCommand(args)
+	var path string
+	asJSON := false
+	for _, arg := range args[cmd.subcmd+1:] {
+		switch {
+		case arg == "-json" || arg == "--json":
+			asJSON = true
+		case strings.HasPrefix(arg, "-"):
+			return fmt.Errorf("unknown argument %q", arg)
+		case path != "":
+			return fmt.Errorf("inspect takes a single binary")
+		default:
+			path = arg
+		}
+	}
+	if path == "" {
+		return fmt.Errorf("usage: govvv inspect [-json] <binary>")
+	}
+
+	res, err := inspectBinary(path)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		b, err := json.MarshalIndent(res, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", b)
+		return err
+	}
+	fmt.Fprintf(w, "%s: %s\n", res.Path, res.GoVersion)
+	if res.Main != "" {
+		fmt.Fprintf(w, "\tmain\t%s\n", res.Main)
+	}
+	for _, v := range res.Values {
+		fmt.Fprintf(w, "\t-X\t%s=%s\t(%s)\n", v.Key, v.Value, v.Source)
+	}
+	return nil
+}
+
+// inspectBinary returns the -X flags of the Go binary at path, from the
+// -ldflags build setting if it is recorded (it is not with -trimpath), or
+// else by reading the variables govvv sets from the symbol table.
+func inspectBinary(path string) (inspectResult, error) {
+	res := inspectResult{Path: path, Values: []inspectValue{}}
+	bi, err := buildinfo.ReadFile(path)
+	if err != nil {
+		return res, fmt.Errorf("cannot read Go build information: %v", err)
+	}
+	res.GoVersion, res.Main = bi.GoVersion, bi.Path
+
+	for _, s := range bi.Settings {
+		if s.Key != "-ldflags" {
+			continue
+		}
+		fields, err := splitLdFlags(s.Value)
+		if err != nil {
+			return res, fmt.Errorf("cannot parse -ldflags build setting: %v", err)
+		}
+		for _, x := range parseXFlags(fields) {
+			res.Values = append(res.Values, inspectValue{x.key, x.value, inspectSourceLdFlags})
+		}
+		return res, nil
+	}
+
+	syms, err := openSymbols(path)
+	if err != nil {
+		return res, err
+	}
+	defer syms.Close()
+	for _, name := range syms.names() {
+		i := strings.LastIndex(name, ".")
+		if i == -1 || !inspectVars[name[i+1:]] {
+			continue
+		}
+		if v, ok := syms.stringVar(name); ok {
+			res.Values = append(res.Values, inspectValue{name, v, inspectSourceSymbols})
+		}
+	}
+	return res, nil
+}
+
+// symbolTable gives access to the symbols and memory image of an executable.
+type symbolTable struct {
+	addrs   map[string]uint64 // symbol addresses by name
+	sizes   map[string]uint64 // symbol sizes by name, if known
+	read    func(addr uint64, n int) ([]byte, error)
+	order   binary.ByteOrder
+	ptrSize int
+	file    io.Closer
+}
+
+// names returns the symbol names in order.
+func (t *symbolTable) names() []string {
+	var out []string
+	for name := range t.addrs {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// stringVar returns the value of the string variable name, if it is set to a
+// non-empty string. A Go string is a pointer to the data and a length.
+func (t *symbolTable) stringVar(name string) (string, bool) {
+	addr, ok := t.addrs[name]
+	if !ok {
+		return "", false
+	}
+	if size := t.sizes[name]; size != 0 && size != uint64(2*t.ptrSize) {
+		return "", false
+	}
+	hdr, err := t.read(addr, 2*t.ptrSize)
+	if err != nil {
+		return "", false // e.g. in .bss, as it is not set
+	}
+	var ptr, n uint64
+	if t.ptrSize == 8 {
+		ptr, n = t.order.Uint64(hdr), t.order.Uint64(hdr[8:])
+	} else {
+		ptr, n = uint64(t.order.Uint32(hdr)), uint64(t.order.Uint32(hdr[4:]))
+	}
+	if n == 0 || n > maxInspectedString {
+		return "", false
+	}
+	b, err := t.read(ptr, int(n))
+	if err != nil || !utf8.Valid(b) {
+		return "", false
+	}
+	return string(b), true
+}
+
+// openSymbols reads the symbol table of an ELF, Mach-O or PE executable.
+func openSymbols(path string) (*symbolTable, error) {
+	var (
+		t   *symbolTable
+		c   io.Closer
+		err error
+	)
+	if f, ferr := elf.Open(path); ferr == nil {
+		c = f
+		t, err = elfSymbols(f)
+	} else if f, ferr := macho.Open(path); ferr == nil {
+		c = f
+		t, err = machoSymbols(f)
+	} else if f, ferr := pe.Open(path); ferr == nil {
+		c = f
+		t, err = peSymbols(f)
+	} else {
+		return nil, fmt.Errorf("%s is not an ELF, Mach-O or PE file", path)
+	}
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	t.file = c
+	return t, nil
+}
+
+// Close closes the executable.
+func (t *symbolTable) Close() error {
+	return t.file.Close()
+}
+
+// readSection reads n bytes at offset off of a section of size size.
+func readSection(r io.ReaderAt, off, size uint64, n int) ([]byte, error) {
+	if off+uint64(n) > size {
+		return nil, fmt.Errorf("out of section bounds")
+	}
+	b := make([]byte, n)
+	if _, err := r.ReadAt(b, int64(off)); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func elfSymbols(f *elf.File) (*symbolTable, error) {
+	syms, err := f.Symbols()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read symbol table (is the binary stripped?): %v", err)
+	}
+	t := &symbolTable{addrs: make(map[string]uint64), sizes: make(map[string]uint64), order: f.ByteOrder, ptrSize: 4}
+	if f.Class == elf.ELFCLASS64 {
+		t.ptrSize = 8
+	}
+	for _, s := range syms {
+		t.addrs[s.Name], t.sizes[s.Name] = s.Value, s.Size
+	}
+	sections := f.Sections
+	t.read = func(addr uint64, n int) ([]byte, error) {
+		for _, s := range sections {
+			if s.Type != elf.SHT_NOBITS && s.Addr != 0 && addr >= s.Addr && addr < s.Addr+s.Size {
+				return readSection(s, addr-s.Addr, s.Size, n)
+			}
+		}
+		return nil, fmt.Errorf("address %#x is not in the file", addr)
+	}
+	return t, nil
+}
+
+func machoSymbols(f *macho.File) (*symbolTable, error) {
+	if f.Symtab == nil {
+		return nil, fmt.Errorf("cannot read symbol table (is the binary stripped?)")
+	}
+	t := &symbolTable{addrs: make(map[string]uint64), order: f.ByteOrder, ptrSize: 4}
+	if f.Magic == macho.Magic64 {
+		t.ptrSize = 8
+	}
+	for _, s := range f.Symtab.Syms {
+		t.addrs[strings.TrimPrefix(s.Name, "_")] = s.Value
+	}
+	const zerofill = 0x1 // S_ZEROFILL section type
+	sections := f.Sections
+	t.read = func(addr uint64, n int) ([]byte, error) {
+		for _, s := range sections {
+			if s.Flags&0xff != zerofill && addr >= s.Addr && addr < s.Addr+s.Size {
+				return readSection(s, addr-s.Addr, s.Size, n)
+			}
+		}
+		return nil, fmt.Errorf("address %#x is not in the file", addr)
+	}
+	return t, nil
+}
+
+func peSymbols(f *pe.File) (*symbolTable, error) {
+	if len(f.Symbols) == 0 {
+		return nil, fmt.Errorf("cannot read symbol table (is the binary stripped?)")
+	}
+	t := &symbolTable{addrs: make(map[string]uint64), order: binary.LittleEndian, ptrSize: 8}
+	var imageBase uint64
+	switch h := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		imageBase, t.ptrSize = uint64(h.ImageBase), 4
+	case *pe.OptionalHeader64:
+		imageBase = h.ImageBase
+	}
+	for _, s := range f.Symbols {
+		if s.SectionNumber <= 0 || int(s.SectionNumber) > len(f.Sections) {
+			continue
+		}
+		sect := f.Sections[s.SectionNumber-1]
+		t.addrs[s.Name] = imageBase + uint64(sect.VirtualAddress) + uint64(s.Value)
+	}
+	sections := f.Sections
+	t.read = func(addr uint64, n int) ([]byte, error) {
+		for _, s := range sections {
+			start := imageBase + uint64(s.VirtualAddress)
+			if addr >= start && addr < start+uint64(s.VirtualSize) {
+				// the part beyond the data in the file is zero-filled
+				return readSection(s, addr-start, uint64(s.Size), n)
+			}
+		}
+		return nil, fmt.Errorf("address %#x is not in the file", addr)
+	}
+	return t, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// buildInspectTestBinary builds a program with string variables set with -X
+// for the given platform and returns its path.
+func buildInspectTestBinary(t *testing.T, dir, goos, goarch string, extra ...string) string {
+	src := filepath.Join(dir, "main.go")
+	require.Nil(t, ioutil.WriteFile(src, []byte(`package main
+
+var Version, GitCommit, GitBranch, Other string
+
+func main() { println(Version, GitCommit, GitBranch, Other) }
+`), 0644))
+	out := filepath.Join(dir, goos+"-"+goarch)
+	args := append([]string{"build", "-o", out,
+		"-ldflags", "-X main.Version=1.2.3 -X 'main.GitCommit=0b5ed7a dirty' -X main.Other=o"}, extra...)
+	cmd := exec.Command("go", append(args, src)...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOOS="+goos, "GOARCH="+goarch, "CGO_ENABLED=0")
+	b, err := cmd.CombinedOutput()
+	require.Nil(t, err, "go build failed: %s", b)
+	return out
+}
+
+func Test_inspectBinary(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds binaries")
+	}
+	dir, err := ioutil.TempDir("", "govvv-test")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// from the -ldflags build setting
+	res, err := inspectBinary(buildInspectTestBinary(t, dir, "linux", "amd64"))
+	require.Nil(t, err)
+	require.Equal(t, []inspectValue{
+		{"main.Version", "1.2.3", inspectSourceLdFlags},
+		{"main.GitCommit", "0b5ed7a dirty", inspectSourceLdFlags},
+		{"main.Other", "o", inspectSourceLdFlags},
+	}, res.Values)
+
+	// from the symbol table, which only has the names govvv sets
+	for _, p := range [][2]string{{"linux", "amd64"}, {"linux", "386"}, {"darwin", "arm64"}, {"windows", "amd64"}} {
+		res, err := inspectBinary(buildInspectTestBinary(t, dir, p[0], p[1], "-trimpath"))
+		require.Nil(t, err, "%s/%s", p[0], p[1])
+		require.Equal(t, []inspectValue{
+			{"main.GitCommit", "0b5ed7a dirty", inspectSourceSymbols},
+			{"main.Version", "1.2.3", inspectSourceSymbols},
+		}, res.Values, "%s/%s", p[0], p[1])
+	}
+
+	// stripped
+	_, err = inspectBinary(buildInspectTestBinary(t, dir, "linux", "amd64", "-trimpath", "-ldflags=-s -w"))
+	require.NotNil(t, err)
+
+	_, err = inspectBinary(filepath.Join(dir, "main.go"))
+	require.NotNil(t, err)
+}
+
+func Test_runInspect(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds binaries")
+	}
+	dir, err := ioutil.TempDir("", "govvv-test")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	bin := buildInspectTestBinary(t, dir, "linux", "amd64")
+
+	var b bytes.Buffer
+	require.Nil(t, runInspect(&b, []string{"inspect", bin}))
+	require.Contains(t, b.String(), "\t-X\tmain.Version=1.2.3\t(ldflags)\n")
+
+	b.Reset()
+	require.Nil(t, runInspect(&b, []string{"inspect", "-json", bin}))
+	var res inspectResult
+	require.Nil(t, json.Unmarshal(b.Bytes(), &res))
+	require.Equal(t, bin, res.Path)
+	require.Len(t, res.Values, 3)
+
+	require.NotNil(t, runInspect(&b, []string{"inspect"}))
+	require.NotNil(t, runInspect(&b, []string{"inspect", "-x", bin}))
+	require.NotNil(t, runInspect(&b, []string{"inspect", bin, bin}))
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// jj reads the metadata of Jujutsu repositories, which are commonly
+// colocated with a git repository whose HEAD is always detached.
+type jj struct {
+	dir string
+}
+
+// newJJ returns the jj backend for dir, or nil if the jj binary is not
+// installed so that a colocated git repository is used instead.
+func newJJ(dir string) vcs {
+	if _, err := exec.LookPath("jj"); err != nil {
+		return nil
+	}
+	return jj{dir}
+}
+
+func (j jj) exec(args ...string) (string, error) {
+	return execIn(j.dir, "jj", append([]string{"--color", "never"}, args...)...)
+}
+
+// log evaluates template against the working-copy commit.
+func (j jj) log(template string) (string, error) {
+	return j.exec("log", "--no-graph", "-r", "@", "-T", template)
+}
+
+// Commit returns the short commit ID of the working-copy commit.
+func (j jj) Commit() (string, error) {
+	return j.log("commit_id.short()")
+}
+
+// ChangeID returns the short change ID of the working-copy commit.
+func (j jj) ChangeID() (string, error) {
+	return j.log("change_id.short()")
+}
+
+// State returns "clean" if the working-copy commit is empty, and "dirty"
+// otherwise.
+func (j jj) State() (string, error) {
+	out, err := j.log("empty")
+	if err != nil {
+		return "", err
+	}
+	if out == "true" {
+		return "clean", nil
+	}
+	return "dirty", nil
+}
+
+// Branch returns the comma-separated names of the local bookmarks pointing to
+// the working-copy commit. If there are none, or an error occurs, returns
+// "HEAD".
+func (j jj) Branch() string {
+	out, err := j.log(`local_bookmarks.map(|b| b.name()).join(",")`)
+	if err != nil || out == "" {
+		return "HEAD"
+	}
+	return out
+}
+
+// Summary returns the first tag pointing to the working-copy commit, or its
+// short commit ID if there is none, followed by "-dirty" if the commit is
+// not empty.
+func (j jj) Summary() (string, error) {
+	out, err := j.log(`tags.map(|t| t.name()).join(",")`)
+	if err != nil {
+		return "", err
+	}
+	summary := strings.Split(out, ",")[0]
+	if summary == "" {
+		if summary, err = j.Commit(); err != nil {
+			return "", err
+		}
+	}
+	state, err := j.State()
+	if err != nil {
+		return "", err
+	}
+	if state == "dirty" {
+		summary += "-dirty"
+	}
+	return summary, nil
+}
+
+// CommitDate returns the committer timestamp of the working-copy commit.
+func (j jj) CommitDate() (time.Time, error) {
+	out, err := j.log(`committer.timestamp().utc().format("%Y-%m-%dT%H:%M:%SZ")`)
+	if err != nil {
+		return time.Time{}, err
+	}
+	t, err := time.Parse(time.RFC3339, out)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("jj: invalid timestamp %q", out)
+	}
+	return t, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJJ(t *testing.T) {
+	if _, err := exec.LookPath("jj"); err != nil {
+		t.Skip("jj is not installed")
+	}
+	dir := tmpDir(t)
+	defer os.RemoveAll(dir)
+
+	repo := jj{dir}
+	_, err := repo.exec("git", "init", "--colocate")
+	require.Nil(t, err, "failed to initialize jj repo")
+	require.Equal(t, repo, detectVCS(dir))
+
+	s, err := repo.State()
+	require.Nil(t, err)
+	require.Equal(t, "clean", s, "new working-copy commit is empty")
+	require.Equal(t, "HEAD", repo.Branch())
+
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "a"), []byte("a"), 0600))
+	s, err = repo.State()
+	require.Nil(t, err)
+	require.Equal(t, "dirty", s)
+
+	_, err = repo.exec("bookmark", "create", "-r", "@", "feature")
+	require.Nil(t, err)
+	require.Equal(t, "feature", repo.Branch())
+
+	c, err := repo.Commit()
+	require.Nil(t, err)
+	require.Regexp(t, "^[0-9a-f]+$", c)
+	id, err := repo.ChangeID()
+	require.Nil(t, err)
+	require.Regexp(t, "^[k-z]+$", id)
+
+	sum, err := repo.Summary()
+	require.Nil(t, err)
+	require.Equal(t, c+"-dirty", sum)
+}
@@ -3,58 +3,456 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"os"
+	"sort"
 	"strings"
+	"unicode"
 )
 
+// ldflagsSpace are the characters the go tool splits -ldflags values on.
+const ldflagsSpace = " \t\n\r"
+
 // mkLdFlags will generate a string compatible to use in "go build --ldflags"
-// with provided values.
+// with provided values. The -X flags are sorted by key so that the output is
+// the same across runs.
 func mkLdFlags(values map[string]string) (string, error) {
-	var b bytes.Buffer
-	var i int
-	for k, v := range values {
-		if len(strings.Fields(k)) > 1 {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var fields []string
+	for _, k := range keys {
+		switch {
+		case k == "":
+			return "", fmt.Errorf("cannot make ldflags for %q: key is empty", k)
+		case strings.IndexFunc(k, unicode.IsSpace) != -1:
 			return "", fmt.Errorf("cannot make ldflags for %q: key contains whitespaces", k)
+		case strings.Contains(k, "="):
+			return "", fmt.Errorf("cannot make ldflags for %q: key contains '='", k)
 		}
-		if len(strings.Fields(v)) > 1 {
-			v = fmt.Sprintf("'%s'", v) // surround it with single quotes
+		fields = append(fields, "-X", k+"="+values[k])
+	}
+	return joinLdFlags(fields)
+}
+
+// splitLdFlags splits an -ldflags value into the arguments passed to the
+// linker, the same way the go tool does (cmd/internal/quoted.Split): fields
+// are separated by spaces, and a field that starts with a single or double
+// quote extends to the next occurrence of the same quote, with no escaping.
+func splitLdFlags(s string) ([]string, error) {
+	var fields []string
+	for {
+		s = strings.TrimLeft(s, ldflagsSpace)
+		if s == "" {
+			return fields, nil
 		}
+		if quote := s[0]; quote == '\'' || quote == '"' {
+			i := strings.IndexByte(s[1:], quote)
+			if i < 0 {
+				return nil, fmt.Errorf("unterminated %c string", quote)
+			}
+			fields = append(fields, s[1:i+1])
+			s = s[i+2:]
+			continue
+		}
+		i := strings.IndexAny(s, ldflagsSpace)
+		if i < 0 {
+			i = len(s)
+		}
+		fields = append(fields, s[:i])
+		s = s[i:]
+	}
+}
 
-		i++
-		b.WriteString(fmt.Sprintf("-X %s=%s", k, v))
-		if i != len(values) {
+// joinLdFlags joins the linker arguments into an -ldflags value that
+// splitLdFlags splits back into the same arguments. Fields that contain
+// spaces or start with a quote are wrapped in single quotes, or double quotes
+// if they contain a single quote. Fields that need quoting but contain both
+// kinds of quotes cannot be represented.
+func joinLdFlags(fields []string) (string, error) {
+	var b bytes.Buffer
+	for i, f := range fields {
+		if i > 0 {
 			b.WriteByte(' ')
 		}
+		needsQuotes := f == "" || strings.ContainsAny(f, ldflagsSpace) || f[0] == '\'' || f[0] == '"'
+		switch {
+		case !needsQuotes:
+			b.WriteString(f)
+		case !strings.Contains(f, "'"):
+			b.WriteString("'" + f + "'")
+		case !strings.Contains(f, `"`):
+			b.WriteString(`"` + f + `"`)
+		default:
+			return "", fmt.Errorf("cannot quote %q for -ldflags: contains spaces and both single and double quotes", f)
+		}
 	}
 	return b.String(), nil
 }
 
-// addLdFlags appends the specified ldflags value to args right after the
-// "build" or "install" arguments. If a -ldflags argument is already present, it
-// normalizes the argument (converts [-ldflags, val] into [-ldflags=val]) and
-// appends the given ldflags value.
-func addLdFlags(args []string, ldflags string) ([]string, error) {
-	if ldIdx := findArg(args, "-ldflags"); ldIdx != -1 { // -ldflag exists, normalize and append
-		args = normalizeArg(args, "-ldflags")
-		args[ldIdx] = appendToFlag(args[ldIdx], ldflags)
-		return args, nil
+// ldflagsSource is a part of the -ldflags values passed to the go tool, and
+// where it came from. pattern is the package pattern the flags apply to, if
+// any.
+type ldflagsSource struct {
+	origin  string
+	pattern string
+	value   string
+}
+
+// origins of ldflagsSource
+const (
+	originGoFlags     = "GOFLAGS"
+	originCommandLine = "command line"
+	originGovvv       = "govvv"
+	originLinker      = "linker"
+)
+
+// String describes the source for -print output.
+func (s ldflagsSource) String() string {
+	if s.pattern != "" {
+		return fmt.Sprintf("-ldflags from %s for %s: %s", s.origin, s.pattern, s.value)
+	}
+	return fmt.Sprintf("-ldflags from %s: %s", s.origin, s.value)
+}
+
+// ldflagsPattern splits an -ldflags value into the package pattern it applies
+// to and the flags, the same way the go tool does for "-ldflags=pattern=flags".
+// A value that starts with "-" has no pattern and applies to the packages
+// named on the command line.
+func ldflagsPattern(v string) (pattern, flags string) {
+	v = strings.TrimSpace(v)
+	if v == "" || strings.HasPrefix(v, "-") {
+		return "", v
+	}
+	i := strings.Index(v, "=")
+	if i < 0 {
+		return "", v // invalid, left for the go tool to report
+	}
+	return strings.TrimSpace(v[:i]), strings.TrimSpace(v[i+1:])
+}
+
+// ldflagsValue is the inverse of ldflagsPattern.
+func ldflagsValue(pattern, flags string) string {
+	if pattern == "" {
+		return flags
+	}
+	return pattern + "=" + flags
+}
+
+// isLdFlagsArg reports whether arg is an -ldflags argument.
+func isLdFlagsArg(arg string) bool {
+	for _, name := range []string{"-ldflags", "--ldflags"} {
+		if arg == name || strings.HasPrefix(arg, name+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// addLdFlags adds the specified ldflags value to every -ldflags argument in
+// args, after normalizing them (converts [-ldflags, val] into [-ldflags=val]).
+// User-supplied flags are kept verbatim in their original order, followed by
+// the given ldflags.
+//
+// The go tool accepts -ldflags multiple times, optionally restricted to a
+// package pattern ("-ldflags=pattern=flags"), and the last one that matches a
+// package wins. Linker flags only matter to the main packages being built,
+// and adding the -X flags to all of the -ldflags arguments ensures that
+// whichever one wins carries them. If no -ldflags argument applies to the
+// packages named on the command line, one is inserted right after the
+// subcommand, ahead of the pattern-specific ones. The arguments passed to the
+// program by "go run" and to the test binary after "go test -args" are left
+// alone.
+//
+// goflags are the -ldflags values set in GOFLAGS, which the go tool applies
+// before the command line ones. They are repeated on the command line with
+// the given ldflags, unless they are overridden by a command line -ldflags
+// with the same pattern.
+//
+// -X keys set by both the user and govvv are resolved according to precedence
+// (see mergeXFlags). The returned report describes where the parts of the
+// final -ldflags values came from, and the conflicting -X keys.
+func addLdFlags(args []string, ldflags string, goflags []string, precedence string) ([]string, ldflagsReport, error) {
+	var report ldflagsReport
+	// leave alone the arguments of the program run by go run or go test
+	end := parseGoCommand(args).flagsEnd()
+	tail := args[end:]
+	args = append([]string(nil), args[:end]...) // do not modify the caller's slice
+	for _, arg := range []string{"-ldflags", "--ldflags"} {
+		for n := len(args); ; n = len(args) {
+			if args = normalizeArg(args, arg); len(args) == n {
+				break
+			}
+		}
+	}
+
+	// merge returns the part of ldflags to append to the flags from origin
+	merge := func(origin, pattern, flags string) (string, error) {
+		if flags != "" {
+			report.sources = append(report.sources, ldflagsSource{origin, pattern, flags})
+		}
+		ours, conflicts, err := mergeXFlags(origin, flags, ldflags, precedence)
+		report.conflicts = append(report.conflicts, conflicts...)
+		return ours, err
+	}
+
+	cmdlinePatterns := make(map[string]bool)
+	for i, arg := range args {
+		if !isLdFlagsArg(arg) {
+			continue
+		}
+		var v string
+		if j := strings.Index(arg, "="); j != -1 {
+			v = arg[j+1:]
+		}
+		pattern, flags := ldflagsPattern(v)
+		cmdlinePatterns[pattern] = true
+		ours, err := merge(originCommandLine, pattern, flags)
+		if err != nil {
+			return nil, report, err
+		}
+		if ours != "" {
+			args[i] = appendToFlag(arg, ours)
+		}
 	}
 
-	// -ldflags argument does not exist in args.
-	// find where to insert the new argument (after "build" or "install")
-	insertIdx := findArg(args, "build")
-	if insertIdx == -1 {
-		insertIdx = findArg(args, "install")
+	// repeat GOFLAGS values that are not overridden on the command line
+	var insert []string
+	for _, v := range goflags {
+		pattern, flags := ldflagsPattern(v)
+		if cmdlinePatterns[pattern] {
+			continue
+		}
+		if pattern == "" {
+			cmdlinePatterns[""] = true
+		}
+		ours, err := merge(originGoFlags, pattern, flags)
+		if err != nil {
+			return nil, report, err
+		}
+		insert = append(insert, "-ldflags", ldflagsValue(pattern, strings.TrimSpace(flags+" "+ours)))
+	}
+	if !cmdlinePatterns[""] {
+		insert = append([]string{"-ldflags", ldflags}, insert...)
 	}
-	if insertIdx == -1 {
-		return nil, fmt.Errorf("cannot locate where to append -ldflags")
+	report.sources = append(report.sources, ldflagsSource{originGovvv, "", ldflags})
+	if len(insert) == 0 {
+		return append(args, tail...), report, nil
 	}
 
-	// allocate a new slice to prevent modifying the old one
-	newArgs := make([]string, insertIdx+1, len(args)+2)
+	// find where to insert the new arguments (after the subcommand)
+	cmd := parseGoCommand(args)
+	if !injectsLdFlags(cmd.subcommand()) {
+		return nil, report, fmt.Errorf("cannot locate where to append -ldflags")
+	}
+	insertIdx := cmd.subcmd
+
+	newArgs := make([]string, insertIdx+1, len(args)+len(insert)+len(tail))
 	copy(newArgs, args[:insertIdx+1])
-	newArgs = append(newArgs, "-ldflags", ldflags)
+	newArgs = append(newArgs, insert...)
 	newArgs = append(newArgs, args[insertIdx+1:]...)
-	return newArgs, nil
+	newArgs = append(newArgs, tail...)
+	return newArgs, report, nil
+}
+
+// values of the -precedence directive
+const (
+	precedenceUser  = "user"  // user-supplied -X flags win (default)
+	precedenceGovvv = "govvv" // govvv's -X flags win
+	precedenceError = "error" // conflicting -X flags are an error
+)
+
+// checkPrecedence returns an error if precedence is not a valid value of the
+// -precedence directive, or empty for the default.
+func checkPrecedence(precedence string) error {
+	switch precedence {
+	case "", precedenceUser, precedenceGovvv, precedenceError:
+		return nil
+	}
+	return fmt.Errorf("unknown precedence %q (must be %q, %q or %q)",
+		precedence, precedenceUser, precedenceGovvv, precedenceError)
+}
+
+// ldflagsReport describes how the -ldflags values passed to the go tool were
+// put together.
+type ldflagsReport struct {
+	sources   []ldflagsSource
+	conflicts []ldflagsConflict
+}
+
+// ldflagsConflict is an -X key that is set more than once in an -ldflags
+// value. The linker uses the last one.
+type ldflagsConflict struct {
+	key     string
+	origins [2]string // origins of the two values, in order of appearance
+	winner  string    // origin of the value that is used
+}
+
+// originName describes an ldflagsSource origin in messages.
+func originName(origin string) string {
+	switch origin {
+	case originCommandLine:
+		return "-ldflags on the command line"
+	case originGoFlags:
+		return "-ldflags in GOFLAGS"
+	case originLinker:
+		return "-ldflags"
+	}
+	return origin
+}
+
+// describe explains the conflict without saying which value is used.
+func (c ldflagsConflict) describe() string {
+	if c.origins[0] == c.origins[1] {
+		return fmt.Sprintf("-X %s is set more than once by %s", c.key, originName(c.origins[0]))
+	}
+	return fmt.Sprintf("-X %s is set by both %s and %s", c.key, originName(c.origins[0]), originName(c.origins[1]))
+}
+
+func (c ldflagsConflict) String() string {
+	if c.origins[0] == c.origins[1] {
+		return c.describe() + ", using the last value"
+	}
+	return fmt.Sprintf("%s, using the value from %s", c.describe(), originName(c.winner))
+}
+
+// xFlag is an "-X key=value" linker argument spanning fields[start:end].
+type xFlag struct {
+	key, value string
+	start, end int
+}
+
+// parseXFlags finds the -X arguments in linker flags, which can be given as
+// "-X key=value" or "-X=key=value", with one or two dashes.
+func parseXFlags(fields []string) []xFlag {
+	var out []xFlag
+	for i := 0; i < len(fields); i++ {
+		name, arg, hasArg := fields[i], "", false
+		if j := strings.Index(name, "="); j != -1 {
+			name, arg, hasArg = name[:j], name[j+1:], true
+		}
+		if name != "-X" && name != "--X" {
+			continue
+		}
+		x := xFlag{start: i, end: i + 1}
+		if !hasArg {
+			if i+1 >= len(fields) {
+				continue
+			}
+			i++
+			arg, x.end = fields[i], i+1
+		}
+		kv := strings.SplitN(arg, "=", 2)
+		x.key = kv[0]
+		if len(kv) == 2 {
+			x.value = kv[1]
+		}
+		out = append(out, x)
+	}
+	return out
+}
+
+// mergeXFlags returns the govvv-generated ldflags to append to the flags from
+// origin, resolving -X keys set by both according to precedence. With the
+// "user" precedence, the conflicting -X flags are dropped from ldflags.
+func mergeXFlags(origin, flags, ldflags, precedence string) (string, []ldflagsConflict, error) {
+	userFields, err := splitLdFlags(flags)
+	if err != nil {
+		return "", nil, fmt.Errorf("cannot parse -ldflags from %s: %v", origin, err)
+	}
+	ourFields, err := splitLdFlags(ldflags)
+	if err != nil {
+		return "", nil, err
+	}
+	keep, conflicts, err := mergeXFields(origin, userFields, ourFields, precedence)
+	if err != nil || len(keep) == len(ourFields) {
+		return ldflags, conflicts, err
+	}
+	out, err := joinLdFlags(keep)
+	return out, conflicts, err
+}
+
+// mergeXFields is mergeXFlags for linker arguments that are already split
+// into fields. It returns the fields of ours to use.
+func mergeXFields(origin string, userFields, ourFields []string, precedence string) ([]string, []ldflagsConflict, error) {
+	if err := checkPrecedence(precedence); err != nil {
+		return nil, nil, err
+	}
+	var conflicts []ldflagsConflict
+	userKeys := make(map[string]bool)
+	for _, x := range parseXFlags(userFields) {
+		if userKeys[x.key] {
+			conflicts = append(conflicts, ldflagsConflict{x.key, [2]string{origin, origin}, origin})
+		}
+		userKeys[x.key] = true
+	}
+
+	drop := make(map[int]bool)
+	for _, x := range parseXFlags(ourFields) {
+		if !userKeys[x.key] {
+			continue
+		}
+		switch precedence {
+		case precedenceUser, "":
+			conflicts = append(conflicts, ldflagsConflict{x.key, [2]string{origin, originGovvv}, origin})
+			for i := x.start; i < x.end; i++ {
+				drop[i] = true
+			}
+		case precedenceGovvv, precedenceError:
+			conflicts = append(conflicts, ldflagsConflict{x.key, [2]string{origin, originGovvv}, originGovvv})
+		}
+	}
+	if precedence == precedenceError && len(conflicts) > 0 {
+		msgs := make([]string, len(conflicts))
+		for i, c := range conflicts {
+			msgs[i] = c.describe()
+		}
+		return nil, nil, fmt.Errorf("conflicting -X flags: %s", strings.Join(msgs, "; "))
+	}
+	if len(drop) == 0 {
+		return ourFields, conflicts, nil
+	}
+
+	var keep []string
+	for i, f := range ourFields {
+		if !drop[i] {
+			keep = append(keep, f)
+		}
+	}
+	return keep, conflicts, nil
+}
+
+// goFlagsLdFlags returns the -ldflags values set in GOFLAGS, which is read
+// from the environment or, if not set there, from "go env GOFLAGS" to include
+// the value set with "go env -w".
+func goFlagsLdFlags() ([]string, error) {
+	goflags, ok := os.LookupEnv("GOFLAGS")
+	if !ok {
+		var err error
+		if goflags, err = goEnv("GOFLAGS"); err != nil {
+			return nil, err
+		}
+	}
+	return ldflagsFromGoFlags(goflags)
+}
+
+// ldflagsFromGoFlags extracts the -ldflags values from a GOFLAGS value.
+func ldflagsFromGoFlags(goflags string) ([]string, error) {
+	fields, err := splitLdFlags(goflags) // same quoting rules as -ldflags
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse GOFLAGS: %v", err)
+	}
+	var ldflags []string
+	for _, f := range fields {
+		for _, prefix := range []string{"-ldflags=", "--ldflags="} {
+			if strings.HasPrefix(f, prefix) {
+				ldflags = append(ldflags, strings.TrimPrefix(f, prefix))
+			}
+		}
+	}
+	return ldflags, nil
 }
 
 // appendToFlag appends val to -arg or -arg=... format. If the flag is missing a
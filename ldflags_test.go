@@ -1,20 +1,100 @@
 package main
 
 import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 )
 
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+// requireGolden compares out with the contents of testdata/name.golden, or
+// overwrites the file with out if the -update flag is set.
+func requireGolden(t *testing.T, name, out string) {
+	fp := filepath.Join("testdata", name+".golden")
+	if *update {
+		require.Nil(t, ioutil.WriteFile(fp, []byte(out), 0644))
+	}
+	b, err := ioutil.ReadFile(fp)
+	require.Nil(t, err, "failed to read golden file (run with -update to create it)")
+	require.Equal(t, string(b), out, "output does not match %s", fp)
+}
+
 func Test_mkldFlags_fails(t *testing.T) {
 	_, err := mkLdFlags(map[string]string{"key space": "val"})
 	require.NotNil(t, err)
 	require.Contains(t, err.Error(), "key contains whitespaces")
 
+	_, err = mkLdFlags(map[string]string{"key=": "val"})
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "key contains '='")
+
+	_, err = mkLdFlags(map[string]string{"": "val"})
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "key is empty")
+
 	_, err = mkLdFlags(map[string]string{"key": "val space"})
 	require.Nil(t, err, "values can have spaces")
 }
 
+func Test_splitLdFlags(t *testing.T) {
+	cases := []struct {
+		in  string
+		out []string
+	}{
+		{"", nil},
+		{"  -s \t-w\n", []string{"-s", "-w"}},
+		{`-X 'main.A=a b' -X "main.B=it's"`, []string{"-X", "main.A=a b", "-X", "main.B=it's"}},
+		{`-X main.A='a`, []string{"-X", "main.A='a"}},
+		{`-X main.A=\"`, []string{"-X", `main.A=\"`}},
+		{`''`, []string{""}},
+	}
+	for _, c := range cases {
+		out, err := splitLdFlags(c.in)
+		require.Nil(t, err)
+		require.Equal(t, c.out, out, "input=%q", c.in)
+	}
+
+	_, err := splitLdFlags(`-X 'main.A=a`)
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "unterminated ' string")
+}
+
+func FuzzMkLdFlags(f *testing.F) {
+	f.Add("main.Version", "1.0.0")
+	f.Add("main.Version", "val 2")
+	f.Add("main.Branch", `it's "quoted"`)
+	f.Add("main.Path", `C:\Program Files\`)
+	f.Add("main.Multi", "line 1\nline 2")
+	f.Add("main.Empty", "")
+	f.Fuzz(func(t *testing.T, k, v string) {
+		if k == "main.Other" {
+			t.Skip()
+		}
+		out, err := mkLdFlags(map[string]string{k: v, "main.Other": "x y"})
+		if err != nil {
+			return // rejected values are covered by Test_mkldFlags_fails
+		}
+		fields, err := splitLdFlags(out)
+		require.Nil(t, err, "ldflags=%q", out)
+
+		got := make(map[string]string)
+		require.Len(t, fields, 4, "ldflags=%q", out)
+		for i := 0; i < len(fields); i += 2 {
+			require.Equal(t, "-X", fields[i])
+			kv := strings.SplitN(fields[i+1], "=", 2)
+			require.Len(t, kv, 2)
+			got[kv[0]] = kv[1]
+		}
+		require.Equal(t, map[string]string{k: v, "main.Other": "x y"}, got, "ldflags=%q", out)
+	})
+}
+
 func Test_mkldFlags(t *testing.T) {
 	{ // empty
 		out, err := mkLdFlags(map[string]string{})
@@ -23,20 +103,78 @@ func Test_mkldFlags(t *testing.T) {
 	}
 	{ // normal input
 		out, err := mkLdFlags(map[string]string{
-			"key1": "val1",
 			"key2": "val 2",
+			"key1": "val1",
+		})
+		require.Nil(t, err)
+		require.Equal(t, "-X key1=val1 -X 'key2=val 2'", out)
+	}
+	{ // quotes and backslashes
+		out, err := mkLdFlags(map[string]string{
+			"a": `it's`,
+			"b": `it's quoted`,
+			"c": `C:\Program Files\`,
+			"d": `'leading`,
+			"e": `say "hi"`,
+			"f": "",
 		})
 		require.Nil(t, err)
-		expected := []string{
-			"-X key1=val1 -X key2='val 2'",
-			"-X key2='val 2' -X key1=val1"}
+		require.Equal(t, `-X a=it's -X "b=it's quoted" -X 'c=C:\Program Files\' -X d='leading -X 'e=say "hi"' -X f=`, out)
+	}
+	{ // cannot be quoted
+		_, err := mkLdFlags(map[string]string{"key": `it's "quoted"`})
+		require.NotNil(t, err)
+		require.Contains(t, err.Error(), "both single and double quotes")
+	}
+}
 
-		if out != expected[0] && out != expected[1] {
-			t.Fatalf("output: %q, expected: either %q --or-- %q", out, expected[0], expected[1])
+func Test_mkLdFlags_golden(t *testing.T) {
+	cases := map[string]map[string]string{
+		"default": {
+			"main.Version":    "1.0.0",
+			"main.BuildDate":  "2017-07-14T02:40:00Z",
+			"main.BuildUnix":  "1500000000",
+			"main.CommitDate": "2017-07-14T02:30:00Z",
+			"main.GitCommit":  "0b5ed7a",
+			"main.GitBranch":  "master",
+			"main.GitState":   "clean",
+			"main.GitSummary": "v1.0.0",
+		},
+		"packages": {
+			"main.GitCommit": "0b5ed7a",
+			"main.BuildDate": "2017-07-14T02:40:00Z",
+			"github.com/acct/coolproject/version.GitCommit":  "0b5ed7a",
+			"github.com/acct/coolproject/version.BuildDate":  "2017-07-14T02:40:00Z",
+			"github.com/acct/coolproject/internal.GitBranch": "feature/x",
+		},
+	}
+	for name, values := range cases {
+		for i := 0; i < 10; i++ { // map iteration order must not matter
+			out, err := mkLdFlags(values)
+			require.Nil(t, err)
+			requireGolden(t, "mkldflags-"+name, out)
 		}
 	}
 }
 
+func Test_addLdFlags_golden(t *testing.T) {
+	ldflags, err := mkLdFlags(map[string]string{
+		"main.GitCommit": "0b5ed7a",
+		"main.BuildDate": "2017-07-14T02:40:00Z",
+		"main.Version":   "1.0.0",
+	})
+	require.Nil(t, err)
+	cases := map[string][]string{
+		"add":      {"build", "-o", "app", "."},
+		"preserve": {"build", "-ldflags", "-s -w -X main.Z=z -X main.A=a", "."},
+	}
+	for name, args := range cases {
+		out, _, err := addLdFlags(args, ldflags, nil, "")
+		require.Nil(t, err)
+		requireGolden(t, "addldflags-"+name, goToolDryRunCmd(out)+"\n")
+	}
+}
+
 func Test_addLdFlags(t *testing.T) {
 	type testcase struct {
 		in  []string
@@ -44,14 +182,14 @@ func Test_addLdFlags(t *testing.T) {
 	}
 	validateCases := func(tc []testcase, ldflagsVal string) {
 		for _, c := range tc {
-			out, err := addLdFlags(c.in, ldflagsVal)
+			out, _, err := addLdFlags(c.in, ldflagsVal, nil, "")
 			require.Nil(t, err)
 			require.Equal(t, c.out, out, "input args=%#v", c.in)
 		}
 	}
 
 	{ // cannot find where to append ldflags
-		_, err := addLdFlags([]string{"a", "b", "c"}, "NEW VALUE")
+		_, _, err := addLdFlags([]string{"a", "b", "c"}, "NEW VALUE", nil, "")
 		require.NotNil(t, err)
 		require.EqualError(t, err, "cannot locate where to append -ldflags")
 	}
@@ -97,11 +235,207 @@ func Test_addLdFlags(t *testing.T) {
 				[]string{"build", "-aflag", "-v", "."},
 				[]string{"build", "-ldflags", val, "-aflag", "-v", "."},
 			},
+			{
+				[]string{"-C", "build", "install", "."},
+				[]string{"-C", "build", "install", "-ldflags", val, "."},
+			},
+			{
+				[]string{"run", ".", "-ldflags", "arg"},
+				[]string{"run", "-ldflags", val, ".", "-ldflags", "arg"},
+			},
+			{
+				[]string{"test", "-c", "./...", "-args", "-ldflags=x"},
+				[]string{"test", "-ldflags", val, "-c", "./...", "-args", "-ldflags=x"},
+			},
 		}
 		validateCases(cases, val)
 	}
 }
 
+func Test_addLdFlags_goflags(t *testing.T) {
+	// merged when -ldflags is not on the command line
+	out, report, err := addLdFlags([]string{"build", "."}, "-X main.A=a", []string{"-s -w"}, "")
+	require.Nil(t, err)
+	require.Equal(t, []string{"build", "-ldflags", "-s -w -X main.A=a", "."}, out)
+	require.Equal(t, []ldflagsSource{
+		{originGoFlags, "", "-s -w"},
+		{originGovvv, "", "-X main.A=a"}}, report.sources)
+
+	// the command line overrides GOFLAGS
+	out, report, err = addLdFlags([]string{"build", "-ldflags=-v", "."}, "-X main.A=a", []string{"-s -w"}, "")
+	require.Nil(t, err)
+	require.Equal(t, []string{"build", "-ldflags=-v -X main.A=a", "."}, out)
+	require.Equal(t, []ldflagsSource{
+		{originCommandLine, "", "-v"},
+		{originGovvv, "", "-X main.A=a"}}, report.sources)
+
+	// pattern-specific GOFLAGS values are kept after the added -ldflags
+	out, report, err = addLdFlags([]string{"build", "."}, "-X main.A=a", []string{"example.com/cmd/...=-s"}, "")
+	require.Nil(t, err)
+	require.Equal(t, []string{"build",
+		"-ldflags", "-X main.A=a",
+		"-ldflags", "example.com/cmd/...=-s -X main.A=a",
+		"."}, out)
+	require.Equal(t, []ldflagsSource{
+		{originGoFlags, "example.com/cmd/...", "-s"},
+		{originGovvv, "", "-X main.A=a"}}, report.sources)
+
+	// nothing to merge
+	_, report, err = addLdFlags([]string{"build"}, "-X main.A=a", nil, "")
+	require.Nil(t, err)
+	require.Equal(t, []ldflagsSource{{originGovvv, "", "-X main.A=a"}}, report.sources)
+}
+
+func Test_addLdFlags_patterns(t *testing.T) {
+	cases := []struct {
+		in, out []string
+	}{
+		{ // repeated, last one wins
+			[]string{"build", "-ldflags", "-s", "-ldflags=-w", "."},
+			[]string{"build", "-ldflags=-s NEW", "-ldflags=-w NEW", "."},
+		},
+		{ // pattern-specific only: added for the command line packages first
+			[]string{"build", "-ldflags=example.com/lib=-v", "."},
+			[]string{"build", "-ldflags", "NEW", "-ldflags=example.com/lib=-v NEW", "."},
+		},
+		{ // pattern-specific after one for the command line packages
+			[]string{"build", "-ldflags=-s", "--ldflags", "all=-w", "./..."},
+			[]string{"build", "-ldflags=-s NEW", "--ldflags=all=-w NEW", "./..."},
+		},
+		{ // empty pattern value
+			[]string{"install", "-ldflags=all=", "."},
+			[]string{"install", "-ldflags", "NEW", "-ldflags=all=NEW", "."},
+		},
+		{ // after the packages in go test
+			[]string{"test", "./...", "-ldflags=-s", "-args", "-v"},
+			[]string{"test", "./...", "-ldflags=-s NEW", "-args", "-v"},
+		},
+		{ // empty value resets the flags for the command line packages
+			[]string{"build", "-ldflags=-s", "-ldflags=", "."},
+			[]string{"build", "-ldflags=-s NEW", "-ldflags=NEW", "."},
+		},
+	}
+	for _, c := range cases {
+		out, _, err := addLdFlags(c.in, "NEW", nil, "")
+		require.Nil(t, err)
+		require.Equal(t, c.out, out, "input args=%#v", c.in)
+	}
+}
+
+func Test_parseXFlags(t *testing.T) {
+	fields := []string{"-s", "-X", "main.A=a", "-X=main.B=b=c", "--X", "main.C", "-w", "-X"}
+	require.Equal(t, []xFlag{
+		{"main.A", "a", 1, 3},
+		{"main.B", "b=c", 3, 4},
+		{"main.C", "", 4, 6},
+	}, parseXFlags(fields))
+}
+
+func Test_mergeXFlags(t *testing.T) {
+	ours := "-X main.A=a -X main.B=b"
+
+	// no conflicts
+	out, conflicts, err := mergeXFlags(originCommandLine, "-s -X main.C=c", ours, "")
+	require.Nil(t, err)
+	require.Equal(t, ours, out)
+	require.Empty(t, conflicts)
+
+	// the user's value wins by default
+	for _, p := range []string{"", precedenceUser} {
+		out, conflicts, err = mergeXFlags(originCommandLine, "-X=main.A=x", ours, p)
+		require.Nil(t, err)
+		require.Equal(t, "-X main.B=b", out)
+		require.Equal(t, []ldflagsConflict{
+			{"main.A", [2]string{originCommandLine, originGovvv}, originCommandLine}}, conflicts)
+		require.Equal(t, "-X main.A is set by both -ldflags on the command line and govvv, "+
+			"using the value from -ldflags on the command line", conflicts[0].String())
+	}
+
+	// govvv's value wins
+	out, conflicts, err = mergeXFlags(originGoFlags, "-X main.A=x", ours, precedenceGovvv)
+	require.Nil(t, err)
+	require.Equal(t, ours, out)
+	require.Equal(t, []ldflagsConflict{
+		{"main.A", [2]string{originGoFlags, originGovvv}, originGovvv}}, conflicts)
+	require.Equal(t, "-X main.A is set by both -ldflags in GOFLAGS and govvv, "+
+		"using the value from govvv", conflicts[0].String())
+
+	// conflicts are errors
+	_, _, err = mergeXFlags(originCommandLine, "-X main.A=x -X main.B=y", ours, precedenceError)
+	require.EqualError(t, err, "conflicting -X flags: "+
+		"-X main.A is set by both -ldflags on the command line and govvv; "+
+		"-X main.B is set by both -ldflags on the command line and govvv")
+	_, _, err = mergeXFlags(originCommandLine, "-s", ours, precedenceError)
+	require.Nil(t, err)
+
+	// unknown precedences are errors even without conflicts
+	for _, flags := range []string{"-s", "-X main.A=x"} {
+		_, _, err = mergeXFlags(originCommandLine, flags, ours, "usr")
+		require.EqualError(t, err, `unknown precedence "usr" (must be "user", "govvv" or "error")`)
+	}
+
+	// the user sets a key twice
+	out, conflicts, err = mergeXFlags(originCommandLine, "-X main.C=1 -X main.C=2", ours, "")
+	require.Nil(t, err)
+	require.Equal(t, ours, out)
+	require.Len(t, conflicts, 1)
+	require.Equal(t, "-X main.C is set more than once by -ldflags on the command line, "+
+		"using the last value", conflicts[0].String())
+
+	// govvv's values are dropped entirely
+	out, _, err = mergeXFlags(originCommandLine, "-X main.A=x -X main.B=y", ours, "")
+	require.Nil(t, err)
+	require.Equal(t, "", out)
+
+	_, _, err = mergeXFlags(originCommandLine, "-X main.A=x", ours, "nope")
+	require.Error(t, err)
+}
+
+func Test_addLdFlags_precedence(t *testing.T) {
+	out, report, err := addLdFlags([]string{"build", "-ldflags=-X main.A=x", "."}, "-X main.A=a -X main.B=b", nil, "")
+	require.Nil(t, err)
+	require.Equal(t, []string{"build", "-ldflags=-X main.A=x -X main.B=b", "."}, out)
+	require.Len(t, report.conflicts, 1)
+
+	out, _, err = addLdFlags([]string{"build", "-ldflags=-X main.A=x", "."}, "-X main.A=a", nil, "")
+	require.Nil(t, err)
+	require.Equal(t, []string{"build", "-ldflags=-X main.A=x", "."}, out)
+
+	out, _, err = addLdFlags([]string{"build", "."}, "-X main.A=a", []string{"-X main.A=x"}, precedenceGovvv)
+	require.Nil(t, err)
+	require.Equal(t, []string{"build", "-ldflags", "-X main.A=x -X main.A=a", "."}, out)
+
+	_, _, err = addLdFlags([]string{"build", "."}, "-X main.A=a", []string{"-X main.A=x"}, precedenceError)
+	require.Error(t, err)
+}
+
+func Test_ldflagsPattern(t *testing.T) {
+	cases := []struct{ in, pattern, flags string }{
+		{"", "", ""},
+		{"-s -w", "", "-s -w"},
+		{" -s", "", "-s"},
+		{"all=-s", "all", "-s"},
+		{"example.com/cmd/...=-X main.A=a", "example.com/cmd/...", "-X main.A=a"},
+		{"all=", "all", ""},
+	}
+	for _, c := range cases {
+		pattern, flags := ldflagsPattern(c.in)
+		require.Equal(t, c.pattern, pattern, "input=%q", c.in)
+		require.Equal(t, c.flags, flags, "input=%q", c.in)
+		if c.in == strings.TrimSpace(c.in) {
+			require.Equal(t, c.in, ldflagsValue(pattern, flags))
+		}
+	}
+}
+
+func Test_goFlagsLdFlags(t *testing.T) {
+	defer os.Setenv("GOFLAGS", os.Getenv("GOFLAGS"))
+	os.Setenv("GOFLAGS", "-mod=mod '-ldflags=-s -w'")
+	v, err := goFlagsLdFlags()
+	require.Nil(t, err)
+	require.Equal(t, []string{"-s -w"}, v)
+}
+
 func Test_appendToFlag(t *testing.T) {
 	v := "VALUE"
 	cases := []struct{ in, out string }{
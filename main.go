@@ -20,6 +20,15 @@ const (
 	flDryRunPrintLdFlags = "-flags"
 	flPackage            = "-pkg"
 	flVersion            = "-version"
+	flDateSource         = "-date-source"
+	flDateFormat         = "-date-format"
+	flDateTimezone       = "-date-tz"
+	flPrecedence         = "-precedence"
+	flConstFile          = "-const-file"
+	flVerify             = "-verify"
+	flStrict             = "-strict"
+	flTarget             = "-target"
+	flVersionFile        = "-version-file"
 )
 
 var (
@@ -30,7 +39,16 @@ var (
 		flDryRun:             false,
 		flDryRunPrintLdFlags: false,
 		flPackage:            true,
-		flVersion:            true}
+		flVersion:            true,
+		flDateSource:         true,
+		flDateFormat:         true,
+		flDateTimezone:       true,
+		flPrecedence:         true,
+		flConstFile:          true,
+		flVerify:             false,
+		flStrict:             false,
+		flTarget:             true,
+		flVersionFile:        true}
 )
 
 func main() {
@@ -39,51 +57,234 @@ func main() {
 		log.Println(`govvv: not enough arguments (try "govvv build .")`)
 		log.Printf("version: %s", versionString())
 		os.Exit(1)
-	} else if args[1] != "build" && args[1] != "install" && args[1] != "list" && !isGovvvDirective(args[1]) {
+	}
+	if tool, ok := toolexecTool(args[1:]); ok {
+		// run by "go build -toolexec=govvv"
+		if err := runToolexec(args[1:], tool); err != nil {
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				os.Exit(exitErr.ExitCode())
+			}
+			log.Fatalf("govvv: %v", err)
+		}
+		return
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		log.Fatalf("govvv: cannot get working directory: %v", err)
+	}
+
+	cmd := parseGoCommand(args[1:])
+	switch sub := cmd.subcommand(); {
+	case injectsLdFlags(sub), sub == "list":
 		// do not wrap the entire 'go tool'
 		// "list" is wrapped to be compatible with mitchellh/gox.
-		log.Fatalf(`govvv: only works with "build", "install" and "list". try "go %s" instead`, args[1])
+	case sub == "inspect":
+		if err := runInspect(os.Stdout, args[1:]); err != nil {
+			log.Fatalf("govvv: %v", err)
+		}
+		return
+	case sub == "config":
+		if err := runConfig(os.Stdout, cmd.workDir(wd), args[1:]); err != nil {
+			log.Fatalf("govvv: %v", err)
+		}
+		return
+	case sub == "generate":
+		if err := runGenerate(cmd.workDir(wd), args[1:]); err != nil {
+			log.Fatalf("govvv: %v", err)
+		}
+		return
+	case sub == "" && isGovvvDirective(args[1]):
+		// only directives, e.g. "govvv -flags"
+	default:
+		if sub == "" {
+			sub = args[1]
+		}
+		log.Fatalf(`govvv: only works with "build", "install", "run", "test", "list", "generate", "inspect" and "config". try "go %s" instead`, sub)
 	}
 
-	wd, err := os.Getwd()
+	// directives from the config file and the environment apply too
+	cfg, err := loadSettings(cmd.workDir(wd), args[1:])
 	if err != nil {
-		log.Fatalf("govvv: cannot get working directory: %v", err)
+		log.Fatalf("govvv: %v", err)
+	}
+	directives := cfg.directives()
+	if precedence, ok := collectGovvvDirective(directives, flPrecedence); ok {
+		if err := checkPrecedence(precedence); err != nil {
+			log.Fatalf("govvv: %v", err)
+		}
 	}
 
-	versionValues, err := GetFlags(wd, args)
+	collected, err := collectValues(cmd.workDir(wd), directives)
 	if err != nil {
 		log.Fatalf("failed to collect values: %v", err)
 	}
+	versionValues, err := chooseTargets(cmd.workDir(wd), collected, directives)
+	if err != nil {
+		log.Fatalf("govvv: %v", err)
+	}
+
+	_, verify := collectGovvvDirective(directives, flVerify)
+	if verify && cmd.subcommand() != "build" && cmd.subcommand() != "install" {
+		log.Fatalf(`govvv: %s only works with "build" and "install"`, flVerify)
+	}
+	// packages whose variables -verify does not require to exist
+	optional := make(map[string]bool)
+
+	// with -const-file, the values are compiled in as constants instead
+	constFile, useConstFile := collectGovvvDirective(directives, flConstFile)
+	useConstFile = useConstFile && injectsLdFlags(cmd.subcommand())
+	var overlayDir string
+	if useConstFile && verify {
+		log.Fatalf("govvv: %s does not work with %s", flVerify, flConstFile)
+	} else if useConstFile {
+		overlayDir, err = writeOverlay(cmd.workDir(wd), constFile, versionValues)
+		if err != nil {
+			log.Fatalf("failed to generate %s: %v", constFile, err)
+		}
+	}
+
+	if !targetsChosen(directives) && !useConstFile && injectsLdFlags(cmd.subcommand()) {
+		// also set the variables of the version package if it is used. if
+		// this cannot be determined, only the main package is targeted.
+		imports, _ := importsPackage(cmd.workDir(wd), cmd.listFlags(), cmd.packages(), cmd.subcommand() == "test", versionPackage)
+		if imports {
+			versionValues = addImportPathKeys(versionValues, []string{versionPackage})
+			optional[defaultPackage] = true
+		}
+	}
+
+	if cmd.subcommand() == "test" {
+		// main packages are linked into test binaries under their import path
+		paths, err := mainPackages(cmd.workDir(wd), cmd.listFlags(), cmd.packages())
+		if err != nil {
+			log.Printf("govvv: warning: cannot find the main packages to test: %v", err)
+		}
+		versionValues = addImportPathKeys(versionValues, paths)
+	}
+
+	_, strict := collectGovvvDirective(directives, flStrict)
+	var problems []targetProblem
+	// variables known to be declared in the packages of the build
+	declared := make(map[string]bool)
+	if sub := cmd.subcommand(); !useConstFile && (sub == "build" || sub == "install" || sub == "run") {
+		// only set the variables that exist and can be set with -X
+		explicit := len(collectGovvvDirectives(directives, flTarget)) > 0
+		targets, p, err := discoverTargets(cmd.workDir(wd), cmd.listFlags(), cmd.packages(), versionValues, collected, explicit, optional)
+		if err != nil && strict {
+			log.Fatalf("govvv: cannot check the variables to set: %v", err)
+		} else if err != nil {
+			log.Printf("govvv: warning: cannot check the variables to set, setting all of them: %v", err)
+		} else {
+			versionValues, problems = targets, p
+			for k := range targets {
+				declared[k] = true
+			}
+		}
+	} else if sub == "test" || sub == "" || useConstFile {
+		// //govvv: annotations are only applied by the discovery above
+		problems = skippedAnnotations(cmd.workDir(wd), cmd.listFlags(), cmd.packages())
+	}
 
 	ldflags, err := mkLdFlags(versionValues)
 	if err != nil {
 		log.Fatalf("failed to compile values: %v", err)
 	}
 
-	if _, ok := collectGovvvDirective(args, flDryRunPrintLdFlags); ok {
+	if _, ok := collectGovvvDirective(directives, flDryRunPrintLdFlags); ok {
+		for _, p := range problems {
+			if p.warn {
+				log.Printf("govvv: warning: %s", p)
+			}
+		}
 		fmt.Print(ldflags)
 		return
 	}
 
 	args = args[1:] // rm executable name
 
-	if args[0] == "build" || args[0] == "install" {
-		args, err = addLdFlags(args, ldflags)
+	var report ldflagsReport
+	if useConstFile {
+		args, err = addOverlay(args, cmd.workDir(wd), overlayDir)
+		if err != nil {
+			os.RemoveAll(overlayDir)
+			log.Fatalf("failed to add -overlay to args: %v", err)
+		}
+	} else if injectsLdFlags(cmd.subcommand()) && ldflags != "" {
+		goflags, err := goFlagsLdFlags()
+		if err != nil {
+			log.Fatalf("failed to read GOFLAGS: %v", err)
+		}
+		precedence, _ := collectGovvvDirective(directives, flPrecedence)
+		args, report, err = addLdFlags(args, ldflags, goflags, precedence)
 		if err != nil {
 			log.Fatalf("failed to add ldflags to args: %v", err)
 		}
 	}
 
-	if _, ok := collectGovvvDirective(args, flDryRun); ok {
+	_, dryRun := collectGovvvDirective(directives, flDryRun)
+	failed := false
+	for _, p := range problems {
+		if dryRun {
+			fmt.Printf("# skipped: %s\n", p)
+		} else if p.warn && strict {
+			log.Printf("govvv: %s", p)
+			failed = true
+		} else if p.warn {
+			log.Printf("govvv: warning: %s", p)
+		}
+	}
+	if failed {
+		log.Fatalf("govvv: variables cannot be set with -X (-strict)")
+	}
+	for _, c := range report.conflicts {
+		if dryRun {
+			fmt.Printf("# warning: %s\n", c)
+		} else {
+			log.Printf("govvv: warning: %s", c)
+		}
+	}
+
+	if dryRun {
+		for _, s := range report.sources {
+			fmt.Printf("# %s\n", s)
+		}
+		if useConstFile {
+			fmt.Printf("# %s is replaced by the files in %s\n", constFile, overlayDir)
+		}
 		fmt.Println(goToolDryRunCmd(args))
 		return
 	}
 
 	args = scrubGovvvDirectives(args)
 
-	if err := execGoTool(args); err != nil {
+	err = execGoTool(args)
+	if overlayDir != "" {
+		os.RemoveAll(overlayDir)
+	}
+	if err != nil {
 		log.Fatalf("go tool: %v", err)
 	}
+
+	if verify {
+		// user-supplied values take precedence
+		skip := make(map[string]bool)
+		for _, c := range report.conflicts {
+			if c.winner != originGovvv {
+				skip[c.key] = true
+			}
+		}
+		bin, err := builtBinary(parseGoCommand(args), cmd.workDir(wd))
+		if err != nil {
+			log.Fatalf("govvv: cannot verify the build: %v", err)
+		}
+		unused, err := verifyBinary(bin, versionValues, skip, optional, declared)
+		for _, k := range unused {
+			log.Printf("govvv: warning: %s is not in %s: the variable is not used, so the linker removed it", k, bin)
+		}
+		if err != nil {
+			log.Fatalf("govvv: %v", err)
+		}
+	}
 }
 
 // execGoTool invokes "go" with given arguments and passes the current
@@ -94,6 +295,12 @@ func execGoTool(args []string) error {
 	return cmd.Run()
 }
 
+// goEnv returns the value of the go environment variable key as reported by
+// "go env".
+func goEnv(key string) (string, error) {
+	return execIn("", "go", "env", key)
+}
+
 // goToolDryRunCmd returns a POSIX shell-compatible command that would normally
 // get executed. Not guaranteed to quote and escape the args very well.
 func goToolDryRunCmd(args []string) string {
@@ -163,3 +370,23 @@ func collectGovvvDirective(args []string, directive string) (argument string, ok
 	}
 	return "", false
 }
+
+// targetsChosen reports whether args choose the variables to set with -pkg or
+// -target, in which case the version package is not targeted automatically.
+func targetsChosen(args []string) bool {
+	_, ok := collectGovvvDirective(args, flPackage)
+	return ok || len(collectGovvvDirectives(args, flTarget)) > 0
+}
+
+// collectGovvvDirectives returns the arguments of all occurrences of a
+// directive that can be specified multiple times, in order.
+func collectGovvvDirectives(args []string, directive string) []string {
+	var values []string
+	for i := 0; i < len(args); i++ {
+		if args[i] == directive && i+1 < len(args) {
+			values = append(values, args[i+1])
+			i++
+		}
+	}
+	return values
+}
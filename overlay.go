@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// goOverlay is the format of the file passed to "go build -overlay".
+type goOverlay struct {
+	Replace map[string]string
+}
+
+// writeOverlay renders values as Go constants into a file in a new temporary
+// directory that replaces target (relative to dir) in the build, and returns
+// the directory. The package of the generated file is the one target belongs
+// to.
+func writeOverlay(dir, target string, values map[string]string) (string, error) {
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(dir, target)
+	}
+	pkg, err := overlayPackageName(target)
+	if err != nil {
+		return "", err
+	}
+	f, err := newGoFile(pkg, values)
+	if err != nil {
+		return "", err
+	}
+	src, err := renderGoFile(defaultGoFileTemplate, f)
+	if err != nil {
+		return "", err
+	}
+
+	tmp, err := ioutil.TempDir("", "govvv-overlay")
+	if err != nil {
+		return "", err
+	}
+	generated := filepath.Join(tmp, filepath.Base(target))
+	if err := ioutil.WriteFile(generated, src, 0644); err != nil {
+		os.RemoveAll(tmp)
+		return "", err
+	}
+	if err := writeOverlayJSON(filepath.Join(tmp, "overlay.json"), goOverlay{
+		Replace: map[string]string{target: generated}}); err != nil {
+		os.RemoveAll(tmp)
+		return "", err
+	}
+	return tmp, nil
+}
+
+// overlayPackageName returns the name of the package the file target belongs
+// to, which may not exist yet.
+func overlayPackageName(target string) (string, error) {
+	if _, err := os.Stat(target); err == nil {
+		return goPackageName(target)
+	}
+	files, err := filepath.Glob(filepath.Join(filepath.Dir(target), "*.go"))
+	if err != nil {
+		return "", err
+	}
+	for _, fp := range files {
+		if !strings.HasSuffix(fp, "_test.go") {
+			return goPackageName(fp)
+		}
+	}
+	return "", fmt.Errorf("cannot determine the package of %s: no Go files in %s", target, filepath.Dir(target))
+}
+
+// writeOverlayJSON writes the overlay file for the go tool.
+func writeOverlayJSON(fp string, o goOverlay) error {
+	b, err := json.MarshalIndent(o, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fp, b, 0644)
+}
+
+// addOverlay adds the -overlay flag for the overlay in tmp (see writeOverlay)
+// to args. If args already has an -overlay flag, the replacements from its
+// file (relative to dir) are merged into the one in tmp, and the flag is
+// replaced, as the go tool only uses the last one.
+func addOverlay(args []string, dir, tmp string) ([]string, error) {
+	fp := filepath.Join(tmp, "overlay.json")
+	args = append([]string(nil), args...) // do not modify the caller's slice
+	cmd := parseGoCommand(args)
+	end := cmd.flagsEnd()
+	head := args[:end]
+	for _, arg := range []string{"-overlay", "--overlay"} {
+		head = normalizeArg(head, arg)
+	}
+	args = append(head, args[end:]...)
+
+	idx := findArg(head, "-overlay")
+	if idx == -1 {
+		idx = findArg(head, "--overlay")
+	}
+	if idx == -1 {
+		cmd = parseGoCommand(args)
+		if !injectsLdFlags(cmd.subcommand()) {
+			return nil, fmt.Errorf("cannot locate where to add -overlay")
+		}
+		out := make([]string, 0, len(args)+1)
+		out = append(out, args[:cmd.subcmd+1]...)
+		out = append(out, "-overlay="+fp)
+		return append(out, args[cmd.subcmd+1:]...), nil
+	}
+
+	var ours, theirs goOverlay
+	b, err := ioutil.ReadFile(fp)
+	if err == nil {
+		err = json.Unmarshal(b, &ours)
+	}
+	if err != nil {
+		return nil, err
+	}
+	userFile := args[idx][strings.Index(args[idx], "=")+1:]
+	if !filepath.IsAbs(userFile) {
+		userFile = filepath.Join(dir, userFile)
+	}
+	if b, err = ioutil.ReadFile(userFile); err == nil {
+		err = json.Unmarshal(b, &theirs)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read -overlay file: %v", err)
+	}
+	for k, v := range ours.Replace {
+		if theirs.Replace == nil {
+			theirs.Replace = make(map[string]string)
+		}
+		theirs.Replace[k] = v
+	}
+	if err := writeOverlayJSON(fp, theirs); err != nil {
+		return nil, err
+	}
+	args[idx] = "-overlay=" + fp
+	return args, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func readOverlay(t *testing.T, fp string) goOverlay {
+	var o goOverlay
+	b, err := ioutil.ReadFile(fp)
+	require.Nil(t, err)
+	require.Nil(t, json.Unmarshal(b, &o))
+	return o
+}
+
+func Test_writeOverlay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "govvv-test")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0644))
+
+	// the replaced file does not need to exist
+	tmp, err := writeOverlay(dir, "version.go", map[string]string{"main.Version": "1.0"})
+	require.Nil(t, err)
+	defer os.RemoveAll(tmp)
+
+	o := readOverlay(t, filepath.Join(tmp, "overlay.json"))
+	generated := filepath.Join(tmp, "version.go")
+	require.Equal(t, map[string]string{filepath.Join(dir, "version.go"): generated}, o.Replace)
+	b, err := ioutil.ReadFile(generated)
+	require.Nil(t, err)
+	require.Contains(t, string(b), "package main\n")
+
+	_, err = writeOverlay(dir, "sub/version.go", nil)
+	require.NotNil(t, err)
+}
+
+func Test_addOverlay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "govvv-test")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	fp := filepath.Join(dir, "overlay.json")
+	require.Nil(t, writeOverlayJSON(fp, goOverlay{Replace: map[string]string{"/src/v.go": "/tmp/v.go"}}))
+
+	out, err := addOverlay([]string{"-C", "x", "build", "-o", "out", "."}, "/src", dir)
+	require.Nil(t, err)
+	require.Equal(t, []string{"-C", "x", "build", "-overlay=" + fp, "-o", "out", "."}, out)
+
+	out, err = addOverlay([]string{"run", ".", "-overlay", "arg"}, "/src", dir)
+	require.Nil(t, err)
+	require.Equal(t, []string{"run", "-overlay=" + fp, ".", "-overlay", "arg"}, out)
+
+	_, err = addOverlay([]string{"list", "."}, "/src", dir)
+	require.NotNil(t, err)
+
+	// merged with the user's overlay
+	require.Nil(t, writeOverlayJSON(filepath.Join(dir, "user.json"), goOverlay{Replace: map[string]string{
+		"a.go":      "b.go",
+		"/src/v.go": "user.go"}}))
+	out, err = addOverlay([]string{"build", "-overlay", "user.json", "."}, dir, dir)
+	require.Nil(t, err)
+	require.Equal(t, []string{"build", "-overlay=" + fp, "."}, out)
+	require.Equal(t, map[string]string{"a.go": "b.go", "/src/v.go": "/tmp/v.go"}, readOverlay(t, fp).Replace)
+
+	_, err = addOverlay([]string{"build", "-overlay=missing.json", "."}, dir, dir)
+	require.NotNil(t, err)
+}
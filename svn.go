@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type svn struct {
+	dir string
+}
+
+func (s svn) exec(args ...string) (string, error) {
+	return execIn(s.dir, "svn", args...)
+}
+
+// Commit returns the revision of the working copy.
+func (s svn) Commit() (string, error) {
+	return s.exec("info", "--show-item", "revision")
+}
+
+// State returns the working copy state indicating whether
+// it is "clean" or "dirty".
+func (s svn) State() (string, error) {
+	out, err := s.exec("status")
+	if err != nil {
+		return "", err
+	}
+	if len(out) > 0 {
+		return "dirty", nil
+	}
+	return "clean", nil
+}
+
+// Branch returns the branch or tag name derived from the standard
+// trunk/branches/tags repository layout. If the layout is not recognized,
+// or an error occurs, returns "HEAD".
+func (s svn) Branch() string {
+	out, err := s.exec("info", "--show-item", "relative-url")
+	if err != nil {
+		return "HEAD"
+	}
+	if name, _ := svnBranch(out); name != "" {
+		return name
+	}
+	return "HEAD"
+}
+
+// Summary returns the tag name if the working copy is a checkout of a tag,
+// or the revision prefixed with "r" otherwise, followed by "-dirty" if there
+// are local changes.
+func (s svn) Summary() (string, error) {
+	rev, err := s.Commit()
+	if err != nil {
+		return "", err
+	}
+	summary := "r" + rev
+	if url, err := s.exec("info", "--show-item", "relative-url"); err == nil {
+		if name, isTag := svnBranch(url); isTag {
+			summary = name
+		}
+	}
+	state, err := s.State()
+	if err != nil {
+		return "", err
+	}
+	if state == "dirty" {
+		summary += "-dirty"
+	}
+	return summary, nil
+}
+
+// CommitDate returns the date of the last change to the working copy.
+func (s svn) CommitDate() (time.Time, error) {
+	out, err := s.exec("info", "--show-item", "last-changed-date")
+	if err != nil {
+		return time.Time{}, err
+	}
+	t, err := time.Parse(time.RFC3339Nano, out)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("svn: invalid date %q", out)
+	}
+	return t.UTC(), nil
+}
+
+// svnBranch extracts the branch name from a repository-relative URL such as
+// "^/project/branches/feature/cmd" and reports whether it is a tag. It
+// returns an empty name if the URL does not follow the standard layout.
+func svnBranch(relURL string) (name string, isTag bool) {
+	parts := strings.Split(strings.TrimPrefix(relURL, "^/"), "/")
+	for i, p := range parts {
+		switch p {
+		case "trunk":
+			return "trunk", false
+		case "branches", "tags":
+			if i+1 < len(parts) && parts[i+1] != "" {
+				return parts[i+1], p == "tags"
+			}
+			return "", false
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_svnBranch(t *testing.T) {
+	cases := []struct {
+		in    string
+		name  string
+		isTag bool
+	}{
+		{"^/trunk", "trunk", false},
+		{"^/trunk/cmd/app", "trunk", false},
+		{"^/branches/feature-x", "feature-x", false},
+		{"^/branches/feature-x/cmd/app", "feature-x", false},
+		{"^/project/tags/v1.0.0", "v1.0.0", true},
+		{"^/tags/", "", false},
+		{"^/somewhere/else", "", false},
+		{"^/", "", false},
+	}
+	for _, c := range cases {
+		name, isTag := svnBranch(c.in)
+		require.Equal(t, c.name, name, "input=%q", c.in)
+		require.Equal(t, c.isTag, isTag, "input=%q", c.in)
+	}
+}
+
+func TestSvn(t *testing.T) {
+	for _, bin := range []string{"svn", "svnadmin"} {
+		if _, err := exec.LookPath(bin); err != nil {
+			t.Skipf("%s is not installed", bin)
+		}
+	}
+	dir := tmpDir(t)
+	defer os.RemoveAll(dir)
+
+	server := filepath.Join(dir, "server")
+	_, err := execIn(dir, "svnadmin", "create", server)
+	require.Nil(t, err)
+	_, err = execIn(dir, "svn", "mkdir", "-q", "-m", "layout", "--parents",
+		"file://"+server+"/trunk", "file://"+server+"/tags")
+	require.Nil(t, err)
+	wc := filepath.Join(dir, "wc")
+	_, err = execIn(dir, "svn", "checkout", "-q", "file://"+server+"/trunk", wc)
+	require.Nil(t, err)
+
+	repo := svn{wc}
+	require.IsType(t, svn{}, detectVCS(wc))
+
+	c, err := repo.Commit()
+	require.Nil(t, err)
+	require.Equal(t, "1", c)
+	require.Equal(t, "trunk", repo.Branch())
+
+	s, err := repo.Summary()
+	require.Nil(t, err)
+	require.Equal(t, "r1", s)
+
+	require.Nil(t, ioutil.WriteFile(filepath.Join(wc, "a"), []byte("a"), 0600))
+	st, err := repo.State()
+	require.Nil(t, err)
+	require.Equal(t, "dirty", st)
+
+	s, err = repo.Summary()
+	require.Nil(t, err)
+	require.Equal(t, "r1-dirty", s)
+}
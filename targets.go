@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"go/token"
+	"path/filepath"
+	"strings"
+)
+
+// chooseTargets returns the values for the variables chosen with the -target
+// directives in args, or values if there are none.
+func chooseTargets(dir string, values map[string]string, args []string) (map[string]string, error) {
+	targets := collectGovvvDirectives(args, flTarget)
+	if len(targets) == 0 {
+		return values, nil
+	}
+	pkg := defaultPackage
+	if value, ok := collectGovvvDirective(args, flPackage); ok {
+		pkg = value
+	}
+	return targetValues(dir, values, targets, pkg)
+}
+
+// targetValues returns the values for the variables chosen with -target
+// directives, "pkg.Var=source" or "Var=source" for a variable in pkg, instead
+// of the default ones in values. source is as in //govvv: comments (see
+// sourceValue). Package directories are resolved in dir. Variables whose
+// source has no value, e.g. there is no version, are not set.
+func targetValues(dir string, values map[string]string, targets []string, pkg string) (map[string]string, error) {
+	out := make(map[string]string)
+	resolved := make(map[string]string)
+	for _, target := range targets {
+		targetPkg, name, source, ok := splitTarget(target)
+		if !ok {
+			return nil, fmt.Errorf("invalid %s %q: want pkg.Var=source", flTarget, target)
+		}
+		if targetPkg == "" {
+			targetPkg = pkg
+		}
+		if isPackageDir(targetPkg) {
+			if _, ok := resolved[targetPkg]; !ok {
+				path, err := execIn(dir, "go", "list", "-f",
+					`{{if eq .Name "main"}}main{{else}}{{.ImportPath}}{{end}}`, targetPkg)
+				if err != nil {
+					return nil, fmt.Errorf("cannot resolve %s %q: %v", flTarget, target, err)
+				}
+				resolved[targetPkg] = strings.TrimSpace(path)
+			}
+			targetPkg = resolved[targetPkg]
+		}
+
+		value, ok, err := sourceValue(source, values)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %v", flTarget, target, err)
+		}
+		if ok {
+			out[targetPkg+"."+name] = value
+		}
+	}
+	return out, nil
+}
+
+// targetsUse reports whether any of the -target directives may refer to the
+// value of the variable name.
+func targetsUse(targets []string, name string) bool {
+	for _, target := range targets {
+		if _, _, source, ok := splitTarget(target); ok && sourceUses(source, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitTarget splits a -target directive into its package (empty if there is
+// none), variable name and source.
+func splitTarget(target string) (pkg, name, source string, ok bool) {
+	i := strings.Index(target, "=")
+	if i == -1 {
+		return "", "", "", false
+	}
+	name, source = target[:i], target[i+1:]
+	if j := strings.LastIndex(name, "."); j != -1 {
+		pkg, name = name[:j], name[j+1:]
+		if pkg == "" {
+			return "", "", "", false
+		}
+	}
+	return pkg, name, source, token.IsIdentifier(name)
+}
+
+// isPackageDir reports whether pkg is the directory of a package rather than
+// its import path, like "./cmd/app".
+func isPackageDir(pkg string) bool {
+	return pkg == "." || pkg == ".." || strings.HasPrefix(pkg, "./") || strings.HasPrefix(pkg, "../") ||
+		filepath.IsAbs(pkg)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_targetValues(t *testing.T) {
+	values := map[string]string{
+		"main.Version":   "1.0.0",
+		"main.GitCommit": "abc1234",
+		"main.GitBranch": "master",
+	}
+	out, err := targetValues("", values, []string{
+		"main.Version=version",
+		"example.com/app/internal/telemetry.ServiceVersion=version",
+		"Revision=commit",
+		`main.Full=value "{{.Version}}+{{.GitCommit}}"`,
+		"main.ChangeID=change-id",
+	}, "main")
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{
+		"main.Version": "1.0.0",
+		"example.com/app/internal/telemetry.ServiceVersion": "1.0.0",
+		"main.Revision": "abc1234",
+		"main.Full":     "1.0.0+abc1234",
+	}, out)
+
+	// without a package, the variable is in -pkg
+	out, err = targetValues("", values, []string{"Revision=commit"}, "example.com/app/build")
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{"example.com/app/build.Revision": "abc1234"}, out)
+
+	for _, target := range []string{"main.Version", "main.=version", ".Version=version", "main.Version=bogus", "main.Bad-Name=commit"} {
+		_, err = targetValues("", values, []string{target}, "main")
+		require.NotNil(t, err, "target %q", target)
+	}
+}
+
+func Test_targetsUse(t *testing.T) {
+	require.True(t, targetsUse([]string{"main.Version=version", "Built=commit-date"}, varCommitDate))
+	require.True(t, targetsUse([]string{`Full=value "{{.Version}} {{.CommitDate}}"`}, varCommitDate))
+	require.False(t, targetsUse([]string{"main.Version=version", "Built=build-date"}, varCommitDate))
+	require.False(t, targetsUse([]string{"CommitDate"}, varCommitDate))
+	require.False(t, targetsUse(nil, varCommitDate))
+}
+
+func Test_targetValues_relative(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs go list")
+	}
+	dir, err := ioutil.TempDir("", "govvv-test")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module app\n"), 0644))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644))
+
+	// main packages are linked as "main"
+	out, err := targetValues(dir, map[string]string{"main.GitCommit": "abc1234"}, []string{"./.Revision=commit"}, "main")
+	require.Nil(t, err)
+	require.Equal(t, map[string]string{"main.Revision": "abc1234"}, out)
+
+	_, err = targetValues(dir, nil, []string{"./missing.Revision=commit"}, "main")
+	require.NotNil(t, err)
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// toolexecCachePrefix is the prefix of the files values are cached in
+	// while govvv runs as "go build -toolexec=govvv".
+	toolexecCachePrefix = "govvv-toolexec-"
+
+	// toolexecCacheAge is how long cached values are used. The cache of a go
+	// command is replaced when it starts linking, so it does not need to
+	// outlive it by much.
+	toolexecCacheAge = time.Hour
+)
+
+// toolexecTool returns the index of the tool in args (without the program
+// name) if govvv is run by "go build -toolexec=govvv". The go tool runs it with
+// the absolute path of the tool and its arguments, after any govvv directives
+// given in the -toolexec value.
+func toolexecTool(args []string) (int, bool) {
+	for i := 0; i < len(args); i++ {
+		if hasArgument, ok := govvvDirectives[args[i]]; ok {
+			if hasArgument {
+				i++
+			}
+			continue
+		}
+		return i, filepath.IsAbs(args[i])
+	}
+	return -1, false
+}
+
+// runToolexec runs the tool at args[tool], adding the -X flags to the
+// invocations of the linker. Other tools are run unchanged.
+func runToolexec(args []string, tool int) error {
+	directives, path, toolArgs := args[:tool], args[tool], args[tool+1:]
+	if strings.TrimSuffix(filepath.Base(path), ".exe") != "link" {
+		return execTool(path, toolArgs)
+	}
+
+	// directives from the config file and the environment apply too
+	wd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("cannot get working directory: %v", err)
+	}
+	cfg, err := loadSettings(wd, directives)
+	if err != nil {
+		return err
+	}
+	directives = cfg.directives()
+
+	// the go command runs "link -V=full" once, before it links any binary
+	toolID := len(toolArgs) == 1 && toolArgs[0] == "-V=full"
+	values, err := toolexecValues(wd, directives, toolID)
+	if err != nil {
+		return err
+	}
+	if !targetsChosen(directives) && linksPackage(toolArgs, versionPackage) {
+		values = addImportPathKeys(values, []string{versionPackage})
+	}
+	ldflags, err := mkLdFlags(values)
+	if err != nil {
+		return fmt.Errorf("failed to compile values: %v", err)
+	}
+
+	if toolID {
+		// the go tool uses the output as the linker's ID in the build cache
+		var stdout bytes.Buffer
+		cmd := exec.Command(path, toolArgs...)
+		cmd.Stdout, cmd.Stderr = &stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			return err
+		}
+		fmt.Println(toolIDWithValues(stdout.String(), ldflags))
+		return nil
+	}
+
+	precedence, _ := collectGovvvDirective(directives, flPrecedence)
+	toolArgs, err = linkArgs(toolArgs, ldflags, precedence)
+	if err != nil {
+		return err
+	}
+	return execTool(path, toolArgs)
+}
+
+// linkArgs adds the -X flags in ldflags to the arguments of the linker, before
+// the last one, which is the main package archive.
+func linkArgs(args []string, ldflags, precedence string) ([]string, error) {
+	if len(args) == 0 {
+		return args, nil
+	}
+	ourFields, err := splitLdFlags(ldflags)
+	if err != nil {
+		return nil, err
+	}
+	userFields := args[:len(args)-1]
+	ourFields, conflicts, err := mergeXFields(originLinker, userFields, ourFields, precedence)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range conflicts {
+		fmt.Fprintf(os.Stderr, "govvv: warning: %s\n", c)
+	}
+	out := make([]string, 0, len(args)+len(ourFields))
+	out = append(out, userFields...)
+	out = append(out, ourFields...)
+	return append(out, args[len(args)-1]), nil
+}
+
+// toolIDWithValues adds a hash of ldflags to the output of "link -V=full", so
+// that the go tool does not reuse a binary linked with other values.
+func toolIDWithValues(line, ldflags string) string {
+	line = strings.TrimSpace(line)
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(ldflags)))[:16]
+	if f := strings.Fields(line); len(f) > 0 && strings.HasPrefix(f[len(f)-1], "buildID=") {
+		// development toolchains only use the build ID
+		return line + ".govvv" + hash
+	}
+	return line + " govvv=" + hash
+}
+
+// linksPackage reports whether the package path is in the import config
+// given to the linker with -importcfg.
+func linksPackage(args []string, path string) bool {
+	var importcfg string
+	for i, arg := range args {
+		if arg == "-importcfg" && i+1 < len(args) {
+			importcfg = args[i+1]
+		} else if strings.HasPrefix(arg, "-importcfg=") {
+			importcfg = strings.TrimPrefix(arg, "-importcfg=")
+		}
+	}
+	if importcfg == "" {
+		return false
+	}
+	b, err := ioutil.ReadFile(importcfg)
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "packagefile "+path+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// toolexecValues returns the values in dir for the go command that runs
+// govvv, caching them for the rest of its invocations, so that every binary is
+// linked with the same values. The values are collected again and replace the
+// cached ones if fresh is true, which is the case when the go command starts
+// linking: as process IDs get reused, especially in containers, the cache may
+// be left over from another go command.
+func toolexecValues(dir string, directives []string, fresh bool) (map[string]string, error) {
+	fp := toolexecCacheFile(dir, directives, os.Getppid())
+	var values map[string]string
+	if cached, ok := readToolexecCache(fp); !fresh && ok && json.Unmarshal([]byte(cached), &values) == nil {
+		return values, nil
+	}
+
+	values, err := GetFlags(dir, directives)
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect values: %v", err)
+	}
+	b, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+
+	removeStaleToolexecCaches()
+	if fresh {
+		if err := replaceToolexecCache(fp, string(b)); err != nil {
+			fmt.Fprintf(os.Stderr, "govvv: warning: cannot cache the values, they are collected for each binary: %v\n", err)
+		}
+		return values, nil
+	}
+	cached := writeToolexecCache(fp, string(b))
+	if err := json.Unmarshal([]byte(cached), &values); err != nil {
+		return nil, fmt.Errorf("cannot read cached values: %v", err)
+	}
+	return values, nil
+}
+
+// toolexecCacheFile returns the file the values in dir are cached in for the
+// go command with process ID ppid.
+func toolexecCacheFile(dir string, directives []string, ppid int) string {
+	key := sha256.Sum256([]byte(strings.Join(append([]string{dir}, directives...), "\x00")))
+	return filepath.Join(os.TempDir(), fmt.Sprintf("%s%d-%x", toolexecCachePrefix, ppid, key[:8]))
+}
+
+// readToolexecCache reads the value cached in fp, if it is fresh.
+func readToolexecCache(fp string) (string, bool) {
+	fi, err := os.Stat(fp)
+	if err != nil || time.Since(fi.ModTime()) > toolexecCacheAge {
+		return "", false
+	}
+	b, err := ioutil.ReadFile(fp)
+	if err != nil {
+		return "", false
+	}
+	return string(b), true
+}
+
+// writeToolexecCache caches v in fp unless another invocation already did,
+// and returns the cached value. Caching is best effort.
+func writeToolexecCache(fp, v string) string {
+	f, err := ioutil.TempFile(filepath.Dir(fp), filepath.Base(fp)+".tmp")
+	if err != nil {
+		return v
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(v)
+	if cerr := f.Close(); err != nil || cerr != nil {
+		return v
+	}
+	// linking fails if the file exists, so the first value written wins
+	if err := os.Link(f.Name(), fp); os.IsExist(err) {
+		if cached, ok := readToolexecCache(fp); ok {
+			return cached
+		}
+	}
+	return v
+}
+
+// replaceToolexecCache caches v in fp, replacing any value cached before.
+func replaceToolexecCache(fp, v string) error {
+	f, err := ioutil.TempFile(filepath.Dir(fp), filepath.Base(fp)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(v)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), fp)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// removeStaleToolexecCaches removes expired cache files.
+func removeStaleToolexecCaches() {
+	files, _ := filepath.Glob(filepath.Join(os.TempDir(), toolexecCachePrefix+"*"))
+	for _, fp := range files {
+		if fi, err := os.Stat(fp); err == nil && time.Since(fi.ModTime()) > toolexecCacheAge {
+			os.Remove(fp)
+		}
+	}
+}
+
+// execTool runs a tool with the current process' standard streams.
+func execTool(path string, args []string) error {
+	cmd := exec.Command(path, args...)
+	cmd.Stdout, cmd.Stderr, cmd.Stdin = os.Stdout, os.Stderr, os.Stdin
+	return cmd.Run()
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_toolexecTool(t *testing.T) {
+	cases := []struct {
+		in  []string
+		idx int
+		ok  bool
+	}{
+		{[]string{"build", "."}, 0, false},
+		{[]string{"/usr/local/go/pkg/tool/linux_amd64/link", "-V=full"}, 0, true},
+		{[]string{"-pkg", "example.com/v", "-date-source", "commit", "/go/pkg/tool/compile", "-o", "x"}, 4, true},
+		{[]string{"-print"}, -1, false},
+	}
+	for _, c := range cases {
+		idx, ok := toolexecTool(c.in)
+		require.Equal(t, c.ok, ok, "input args=%#v", c.in)
+		if ok {
+			require.Equal(t, c.idx, idx, "input args=%#v", c.in)
+		}
+	}
+}
+
+func Test_linkArgs(t *testing.T) {
+	args := []string{"-o", "a.out", "-X=runtime.godebugDefault=x", "-X", "main.Version=dev", "-buildmode=exe", "_pkg_.a"}
+	out, err := linkArgs(args, "-X main.GitCommit=abc -X main.Version=1.0", "")
+	require.Nil(t, err)
+	require.Equal(t, []string{"-o", "a.out", "-X=runtime.godebugDefault=x", "-X", "main.Version=dev", "-buildmode=exe",
+		"-X", "main.GitCommit=abc", "_pkg_.a"}, out)
+
+	out, err = linkArgs(args, "-X main.GitCommit=abc -X main.Version=1.0", precedenceGovvv)
+	require.Nil(t, err)
+	require.Equal(t, []string{"-o", "a.out", "-X=runtime.godebugDefault=x", "-X", "main.Version=dev", "-buildmode=exe",
+		"-X", "main.GitCommit=abc", "-X", "main.Version=1.0", "_pkg_.a"}, out)
+
+	_, err = linkArgs(args, "-X main.Version=1.0", precedenceError)
+	require.EqualError(t, err, "conflicting -X flags: -X main.Version is set by both -ldflags and govvv")
+}
+
+func Test_toolIDWithValues(t *testing.T) {
+	release := toolIDWithValues("link version go1.21.0\n", "-X main.A=a")
+	require.Regexp(t, `^link version go1.21.0 govvv=[0-9a-f]{16}$`, release)
+	require.NotEqual(t, release, toolIDWithValues("link version go1.21.0\n", "-X main.A=b"))
+
+	devel := toolIDWithValues("link version devel go1.22-abc buildID=x/y\n", "-X main.A=a")
+	require.Regexp(t, `^link version devel go1.22-abc buildID=x/y\.govvv[0-9a-f]{16}$`, devel)
+}
+
+func Test_toolexecCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "govvv-test")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	fp := filepath.Join(dir, "cache")
+
+	_, ok := readToolexecCache(fp)
+	require.False(t, ok)
+
+	// the first value written wins
+	require.Equal(t, "first", writeToolexecCache(fp, "first"))
+	require.Equal(t, "first", writeToolexecCache(fp, "second"))
+	v, ok := readToolexecCache(fp)
+	require.True(t, ok)
+	require.Equal(t, "first", v)
+
+	// replaced
+	require.Nil(t, replaceToolexecCache(fp, "third"))
+	v, ok = readToolexecCache(fp)
+	require.True(t, ok)
+	require.Equal(t, "third", v)
+
+	// expired
+	old := time.Now().Add(-2 * toolexecCacheAge)
+	require.Nil(t, os.Chtimes(fp, old, old))
+	_, ok = readToolexecCache(fp)
+	require.False(t, ok)
+}
+
+func Test_toolexecValues(t *testing.T) {
+	repo1, repo2 := newRepo(t), newRepo(t)
+	defer os.RemoveAll(repo1.dir)
+	defer os.RemoveAll(repo2.dir)
+	mkCommit(t, repo1, "commit 1")
+	mkCommit(t, repo2, "commit 2")
+	mkCommit(t, repo2, "commit 3")
+	defer os.Remove(toolexecCacheFile(repo1.dir, nil, os.Getppid()))
+	defer os.Remove(toolexecCacheFile(repo2.dir, nil, os.Getppid()))
+
+	// the same go command in other directories does not share values
+	require.NotEqual(t, toolexecCacheFile(repo1.dir, nil, 1), toolexecCacheFile(repo2.dir, nil, 1))
+	v1, err := toolexecValues(repo1.dir, nil, true)
+	require.Nil(t, err)
+	v2, err := toolexecValues(repo2.dir, nil, true)
+	require.Nil(t, err)
+	require.NotEqual(t, v1["main.GitCommit"], v2["main.GitCommit"])
+
+	// but it does in the same one
+	mkCommit(t, repo1, "commit 4")
+	cached, err := toolexecValues(repo1.dir, nil, false)
+	require.Nil(t, err)
+	require.Equal(t, v1, cached)
+
+	// until the next go command (possibly with the same process ID) starts
+	fresh, err := toolexecValues(repo1.dir, nil, true)
+	require.Nil(t, err)
+	require.NotEqual(t, v1["main.GitCommit"], fresh["main.GitCommit"])
+	cached, err = toolexecValues(repo1.dir, nil, false)
+	require.Nil(t, err)
+	require.Equal(t, fresh, cached)
+}
+
+func Test_linksPackage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "govvv-test")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	fp := filepath.Join(dir, "importcfg.link")
+	require.Nil(t, ioutil.WriteFile(fp, []byte("# import config\n"+
+		"packagefile github.com/ahmetb/govvv/version=/tmp/b002/_pkg_.a\n"+
+		"packagefile runtime=/tmp/b003/_pkg_.a\n"), 0644))
+
+	require.True(t, linksPackage([]string{"-o", "a.out", "-importcfg", fp, "_pkg_.a"}, versionPackage))
+	require.True(t, linksPackage([]string{"-importcfg=" + fp, "_pkg_.a"}, "runtime"))
+	require.False(t, linksPackage([]string{"-importcfg", fp, "_pkg_.a"}, "github.com/ahmetb/govvv"))
+	require.False(t, linksPackage([]string{"_pkg_.a"}, versionPackage))
+}
@@ -11,9 +11,19 @@ import (
 
 const versionFile = "VERSION"
 
-// GetFlags collects data to be passed as ldflags.
+// GetFlags collects data to be passed as ldflags from the working copy dir
+// belongs to.
 func GetFlags(dir string, args []string) (map[string]string, error) {
-	repo := git{dir}
+	v, err := collectValues(dir, args)
+	if err != nil {
+		return nil, err
+	}
+	return chooseTargets(dir, v, args)
+}
+
+// collectValues collects the values for the variables govvv sets by default.
+func collectValues(dir string, args []string) (map[string]string, error) {
+	repo := detectVCS(dir)
 	gitBranch := repo.Branch()
 	gitCommit, err := repo.Commit()
 	if err != nil {
@@ -28,6 +38,13 @@ func GetFlags(dir string, args []string) (map[string]string, error) {
 		return nil, fmt.Errorf("failed to get repository summary: %v", err)
 	}
 
+	// the commit date is looked up at most once, and only if it is used
+	dated := &commitDateOnce{vcs: repo}
+	buildDate, err := buildTime(dated, args)
+	if err != nil {
+		return nil, err
+	}
+
 	// prefix keys with package to be used by ldflags -X
 	pkg := defaultPackage
 	if value, ok := collectGovvvDirective(args, flPackage); ok {
@@ -35,16 +52,57 @@ func GetFlags(dir string, args []string) (map[string]string, error) {
 	}
 
 	v := map[string]string{
-		pkg + ".BuildDate":  date(),
 		pkg + ".GitCommit":  gitCommit,
 		pkg + ".GitBranch":  gitBranch,
 		pkg + ".GitState":   gitState,
 		pkg + ".GitSummary": gitSummary,
 	}
 
+	dates := map[string]time.Time{
+		varBuildDate: buildDate,
+		varBuildUnix: buildDate,
+	}
+	source, _ := collectGovvvDirective(args, flDateSource)
+	targets := collectGovvvDirectives(args, flTarget)
+	switch {
+	case source == dateSourceCommit || targetsUse(targets, varCommitDate):
+		commitDate, err := dated.CommitDate()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get commit date: %v", err)
+		}
+		dates[varCommitDate] = commitDate
+	case len(targets) == 0:
+		// set by default, unless the commit date cannot be determined
+		if commitDate, err := dated.CommitDate(); err == nil {
+			dates[varCommitDate] = commitDate
+		}
+	}
+	for name, t := range dates {
+		if v[pkg+"."+name], err = formatDateVar(args, name, t); err != nil {
+			return nil, err
+		}
+	}
+
+	if c, ok := repo.(changeIDer); ok {
+		changeID, err := c.ChangeID()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get change id: %v", err)
+		}
+		v[pkg+".ChangeID"] = changeID
+	}
+
 	// calculate the version
 	if value, ok := collectGovvvDirective(args, flVersion); ok {
 		v[pkg+".Version"] = value
+	} else if fp, ok := collectGovvvDirective(args, flVersionFile); ok {
+		if !filepath.IsAbs(fp) {
+			fp = filepath.Join(dir, fp)
+		}
+		b, err := ioutil.ReadFile(fp)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read version file: %v", err)
+		}
+		v[pkg+".Version"] = string(bytes.TrimSpace(b))
 	} else {
 		value, err := versionFromFile(dir)
 		if err != nil {
@@ -57,9 +115,20 @@ func GetFlags(dir string, args []string) (map[string]string, error) {
 	return v, nil
 }
 
-// date returns the UTC date formatted in RFC 3339 layout.
-func date() string {
-	return time.Now().UTC().Format(time.RFC3339)
+// commitDateOnce is a vcs that looks up the commit date at most once.
+type commitDateOnce struct {
+	vcs
+	done bool
+	date time.Time
+	err  error
+}
+
+func (c *commitDateOnce) CommitDate() (time.Time, error) {
+	if !c.done {
+		c.date, c.err = c.vcs.CommitDate()
+		c.done = true
+	}
+	return c.date, c.err
 }
 
 // versionFromFile looks for a file named VERSION in dir if it exists and
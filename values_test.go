@@ -5,6 +5,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -18,11 +19,6 @@ func TestGetFlags_error(t *testing.T) {
 	require.Contains(t, err.Error(), "failed to get commit")
 }
 
-func Test_date(t *testing.T) {
-	v := date()
-	require.Regexp(t, "^[0-9]{4}(-[0-9]{2}){2}T([0-9]{2}:){2}[0-9]{2}Z$", v)
-}
-
 func TestGetFlags(t *testing.T) {
 	// prepare the repo
 	repo := newRepo(t)
@@ -40,6 +36,8 @@ func TestGetFlags(t *testing.T) {
 	require.Equal(t, "master", fl["main.GitBranch"])
 	require.Equal(t, "clean", fl["main.GitState"])
 	require.Equal(t, fl["main.GitCommit"], fl["main.GitSummary"])
+	require.Regexp(t, "^[0-9]+$", fl["main.BuildUnix"])
+	require.Regexp(t, "^[0-9]{4}(-[0-9]{2}){2}T([0-9]{2}:){2}[0-9]{2}Z$", fl["main.CommitDate"])
 }
 
 func TestGetFlags_versionDefault(t *testing.T) {
@@ -94,6 +92,30 @@ func TestGetFlags_versionFlagOverrides(t *testing.T) {
 	require.Equal(t, "2.0.0-RC01", fl["main.Version"])
 }
 
+func TestGetFlags_versionFileFlag(t *testing.T) {
+	// prepare the repo
+	repo := newRepo(t)
+	defer os.RemoveAll(repo.dir)
+	mkCommit(t, repo, "commit 1")
+
+	// -version-file is read instead of VERSION, relative to the directory
+	require.Nil(t, ioutil.WriteFile(filepath.Join(repo.dir, "VERSION"), []byte("2.0.0-beta\n"), 0600))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(repo.dir, "RELEASE"), []byte("3.0.0\n"), 0600))
+	fl, err := GetFlags(repo.dir, []string{flVersionFile, "RELEASE"})
+	require.Nil(t, err)
+	require.Equal(t, "3.0.0", fl["main.Version"])
+
+	// -version takes precedence
+	fl, err = GetFlags(repo.dir, []string{flVersionFile, "RELEASE", flVersion, "2.0.0-RC01"})
+	require.Nil(t, err)
+	require.Equal(t, "2.0.0-RC01", fl["main.Version"])
+
+	// unlike VERSION, it must exist
+	_, err = GetFlags(repo.dir, []string{flVersionFile, "MISSING"})
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "failed to read version file")
+}
+
 func TestGetFlags_versionFileError(t *testing.T) {
 	// prepare the repo
 	repo := newRepo(t)
@@ -107,6 +129,32 @@ func TestGetFlags_versionFileError(t *testing.T) {
 	require.Contains(t, err.Error(), "failed to read version file")
 }
 
+func TestGetFlags_commitDateTarget(t *testing.T) {
+	// prepare the repo
+	repo := newRepo(t)
+	defer os.RemoveAll(repo.dir)
+	mkCommit(t, repo, "commit 1")
+
+	// the commit date is only set for the targets that use it
+	fl, err := GetFlags(repo.dir, []string{flTarget, "main.Revision=commit", flTarget, "main.Built=commit-date"})
+	require.Nil(t, err)
+	require.Regexp(t, "^[0-9]{4}(-[0-9]{2}){2}T([0-9]{2}:){2}[0-9]{2}Z$", fl["main.Built"])
+
+	v, err := collectValues(repo.dir, []string{flTarget, "main.Revision=commit"})
+	require.Nil(t, err)
+	require.NotContains(t, v, "main.CommitDate")
+}
+
+func Test_commitDateOnce(t *testing.T) {
+	repo := &countingVCS{}
+	c := &commitDateOnce{vcs: repo}
+	for i := 0; i < 2; i++ {
+		_, err := c.CommitDate()
+		require.Nil(t, err)
+	}
+	require.Equal(t, 1, repo.commitDates)
+}
+
 func TestGetFlags_pkgFlag(t *testing.T) {
 	// prepare the repo
 	repo := newRepo(t)
@@ -160,6 +208,17 @@ func Test_versionFromFile(t *testing.T) {
 
 // Test utilities
 
+// countingVCS is a vcs that counts the lookups of the commit date.
+type countingVCS struct {
+	vcs
+	commitDates int
+}
+
+func (c *countingVCS) CommitDate() (time.Time, error) {
+	c.commitDates++
+	return time.Unix(1500000000, 0), nil
+}
+
 func tmpDir(t *testing.T) string {
 	dir, err := ioutil.TempDir("", "")
 	require.Nil(t, err, "failed to create test directory")
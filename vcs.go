@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// vcs is implemented by the version control systems govvv can collect build
+// metadata from.
+type vcs interface {
+	// Commit returns the short identifier of the checked out revision.
+	Commit() (string, error)
+
+	// State returns "clean" or "dirty" depending on whether the working
+	// copy has changes.
+	State() (string, error)
+
+	// Branch returns the name of the current branch, or "HEAD" if it
+	// cannot be determined.
+	Branch() string
+
+	// Summary returns a "git describe"-like description of the checked out
+	// revision.
+	Summary() (string, error)
+
+	// CommitDate returns the time the checked out revision was committed.
+	CommitDate() (time.Time, error)
+}
+
+// changeIDer is implemented by version control systems that identify
+// revisions with a stable change ID in addition to the commit hash.
+type changeIDer interface {
+	ChangeID() (string, error)
+}
+
+// vcsMarker associates a file or directory found at the root of a working copy
+// with a function that constructs the vcs for that working copy. The function
+// returns nil if the vcs cannot be used, in which case the next marker is
+// checked.
+type vcsMarker struct {
+	name string
+	new  func(dir string) vcs
+}
+
+// vcsMarkers lists the supported version control systems in the order they
+// are checked for within a single directory.
+var vcsMarkers = []vcsMarker{
+	{".jj", newJJ},
+	{".git", newGit},
+	{".hg", func(dir string) vcs { return hg{dir} }},
+	{".svn", func(dir string) vcs { return svn{dir} }},
+	{".fslckout", func(dir string) vcs { return fossil{dir} }},
+	{"_FOSSIL_", func(dir string) vcs { return fossil{dir} }},
+}
+
+// detectVCS finds the working copy dir belongs to by walking up the directory
+// tree and returns the vcs for it. If no working copy is found, it falls back
+// to git so that callers get git's error messages.
+func detectVCS(dir string) vcs {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return git{dir}
+	}
+	for d := abs; ; d = filepath.Dir(d) {
+		for _, m := range vcsMarkers {
+			if _, err := os.Stat(filepath.Join(d, m.name)); err != nil {
+				continue
+			}
+			if v := m.new(dir); v != nil {
+				return v
+			}
+		}
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+	return git{dir}
+}
+
+// newGit returns the git backend for dir, or one that reads the repository
+// directly if the git binary is not installed.
+func newGit(dir string) vcs {
+	if _, err := exec.LookPath("git"); err != nil {
+		return gitNative{dir}
+	}
+	return git{dir}
+}
+
+// parseUnixTime parses a decimal Unix timestamp in seconds.
+func parseUnixTime(s string) (time.Time, error) {
+	sec, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q", s)
+	}
+	return time.Unix(sec, 0).UTC(), nil
+}
+
+// execIn runs the named program with args in dir and returns its standard
+// output with the surrounding whitespace trimmed.
+func execIn(dir, name string, args ...string) (string, error) {
+	var errOut bytes.Buffer
+	c := exec.Command(name, args...)
+	c.Dir = dir
+	c.Stderr = &errOut
+	out, err := c.Output()
+	outStr := strings.TrimSpace(string(out))
+	if err != nil {
+		err = fmt.Errorf("%s: error=%q stderr=%s", name, err, string(errOut.Bytes()))
+	}
+	return outStr, err
+}
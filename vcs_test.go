@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_detectVCS(t *testing.T) {
+	dir := tmpDir(t)
+	defer os.RemoveAll(dir)
+
+	// nothing found, falls back to git
+	require.Equal(t, git{dir}, detectVCS(dir))
+
+	sub := filepath.Join(dir, "a", "b")
+	require.Nil(t, os.MkdirAll(sub, 0755))
+	require.Nil(t, os.Mkdir(filepath.Join(dir, ".hg"), 0755))
+	require.Equal(t, hg{sub}, detectVCS(sub), "should find the working copy in a parent directory")
+
+	// a nested git repository wins over the outer hg repository
+	require.Nil(t, os.Mkdir(filepath.Join(dir, "a", ".git"), 0755))
+	require.Equal(t, git{sub}, detectVCS(sub))
+}
+
+func Test_detectVCS_markers(t *testing.T) {
+	cases := []struct {
+		marker string
+		isDir  bool
+		want   func(dir string) vcs
+	}{
+		{".svn", true, func(dir string) vcs { return svn{dir} }},
+		{".fslckout", false, func(dir string) vcs { return fossil{dir} }},
+		{"_FOSSIL_", false, func(dir string) vcs { return fossil{dir} }},
+	}
+	for _, c := range cases {
+		dir := tmpDir(t)
+		defer os.RemoveAll(dir)
+
+		p := filepath.Join(dir, c.marker)
+		if c.isDir {
+			require.Nil(t, os.Mkdir(p, 0755))
+		} else {
+			require.Nil(t, ioutil.WriteFile(p, nil, 0600))
+		}
+		require.Equal(t, c.want(dir), detectVCS(dir), "marker=%s", c.marker)
+	}
+}
+
+func Test_detectVCS_jj(t *testing.T) {
+	dir := tmpDir(t)
+	defer os.RemoveAll(dir)
+	require.Nil(t, os.Mkdir(filepath.Join(dir, ".jj"), 0755))
+	require.Nil(t, os.Mkdir(filepath.Join(dir, ".git"), 0755))
+
+	if _, err := exec.LookPath("jj"); err != nil {
+		require.Equal(t, newGit(dir), detectVCS(dir), "colocated git repository is used without jj")
+	} else {
+		require.Equal(t, jj{dir}, detectVCS(dir))
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// builtBinary returns the path of the executable built by a go build or
+// install command line, run in dir.
+func builtBinary(cmd goCommand, dir string) (string, error) {
+	out, hasOut := cmd.flagValue("-o")
+	if hasOut && !filepath.IsAbs(out) {
+		out = filepath.Join(dir, out)
+	}
+	if cmd.subcommand() == "build" && hasOut && !strings.HasSuffix(out, "/") {
+		if fi, err := os.Stat(out); err != nil || !fi.IsDir() {
+			return out, nil
+		}
+	}
+
+	pkgs := cmd.packages()
+	files := len(pkgs) > 0
+	for _, p := range pkgs {
+		files = files && strings.HasSuffix(p, ".go")
+	}
+	if len(pkgs) > 1 && !files {
+		return "", fmt.Errorf("cannot verify a build of multiple packages")
+	}
+	targets, err := execIn(dir, "go", append([]string{"list", "-f", "{{.Target}}"}, pkgs...)...)
+	if err != nil {
+		return "", err
+	}
+	target := strings.TrimSpace(targets)
+	if files && cmd.subcommand() == "build" {
+		// named after the first file
+		exe, err := goEnv("GOEXE")
+		if err != nil {
+			return "", err
+		}
+		target = strings.TrimSuffix(filepath.Base(pkgs[0]), ".go") + exe
+	}
+	if target == "" || strings.Contains(target, "\n") {
+		return "", fmt.Errorf("cannot determine the executable built from %s", strings.Join(pkgs, " "))
+	}
+	switch {
+	case cmd.subcommand() == "install":
+		return target, nil
+	case hasOut:
+		return filepath.Join(out, filepath.Base(target)), nil
+	}
+	return filepath.Join(dir, filepath.Base(target)), nil
+}
+
+// verifyBinary checks that every variable in values is set to its value in
+// the executable at path, except for the skipped ones. The variables of the
+// optional packages do not have to exist. The declared variables (known to
+// exist in the source) that are not in the executable were removed by the
+// linker because they are not used; they are returned as unused rather than
+// reported as errors.
+func verifyBinary(path string, values map[string]string, skip, optional, declared map[string]bool) (unused []string, err error) {
+	syms, err := openSymbols(path)
+	if err != nil {
+		return nil, err
+	}
+	defer syms.Close()
+
+	var msgs []string
+	for key, want := range values {
+		if skip[key] {
+			continue
+		}
+		if _, ok := syms.addrs[key]; !ok {
+			if declared[key] {
+				unused = append(unused, key)
+			} else if !optional[key[:strings.LastIndex(key, ".")]] {
+				msgs = append(msgs, fmt.Sprintf("%s is not set: the variable does not exist or is not used", key))
+			}
+			continue
+		}
+		if got, _ := syms.stringVar(key); got != want {
+			msgs = append(msgs, fmt.Sprintf("%s is %q, want %q", key, got, want))
+		}
+	}
+	sort.Strings(unused)
+	if len(msgs) == 0 {
+		return unused, nil
+	}
+	sort.Strings(msgs)
+	return unused, fmt.Errorf("verification of %s failed:\n\t%s", path, strings.Join(msgs, "\n\t"))
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_builtBinary(t *testing.T) {
+	dir, err := ioutil.TempDir("", "govvv-test")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module app\n"), 0644))
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644))
+
+	bin, err := builtBinary(parseGoCommand([]string{"build", "-o", "bin/app", "."}), dir)
+	require.Nil(t, err)
+	require.Equal(t, filepath.Join(dir, "bin/app"), bin)
+	abs := filepath.Join(dir, "out", "app")
+	bin, err = builtBinary(parseGoCommand([]string{"build", "-o", abs, "."}), dir)
+	require.Nil(t, err)
+	require.Equal(t, abs, bin)
+
+	exe, err := goEnv("GOEXE")
+	require.Nil(t, err)
+	bin, err = builtBinary(parseGoCommand([]string{"build", "main.go"}), dir)
+	require.Nil(t, err)
+	require.Equal(t, filepath.Join(dir, "main"+exe), bin)
+
+	_, err = builtBinary(parseGoCommand([]string{"build", "./a", "./b"}), dir)
+	require.EqualError(t, err, "cannot verify a build of multiple packages")
+}
+
+func Test_verifyBinary(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds binaries")
+	}
+	dir, err := ioutil.TempDir("", "govvv-test")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	bin := buildInspectTestBinary(t, dir, "linux", "amd64")
+
+	values := map[string]string{
+		"main.Version":   "1.2.3",
+		"main.GitCommit": "0b5ed7a dirty",
+		"main.GitBranch": "",
+	}
+	unused, err := verifyBinary(bin, values, nil, nil, nil)
+	require.Nil(t, err)
+	require.Empty(t, unused)
+
+	values["main.Other"] = "other"
+	values["main.GitSummary"] = "v1.2.3"
+	_, err = verifyBinary(bin, values, nil, nil, nil)
+	require.EqualError(t, err, "verification of "+bin+" failed:\n"+
+		"\tmain.GitSummary is not set: the variable does not exist or is not used\n"+
+		"\tmain.Other is \"o\", want \"other\"")
+
+	// declared variables that are missing were removed by the linker
+	values["main.Other"] = "o"
+	unused, err = verifyBinary(bin, values, nil, nil, map[string]bool{"main.GitSummary": true, "main.Version": true})
+	require.Nil(t, err)
+	require.Equal(t, []string{"main.GitSummary"}, unused)
+
+	// skipped, and an optional package that is not used
+	_, err = verifyBinary(bin, map[string]string{
+		"main.Version":          "1.2.3",
+		"main.Other":            "other",
+		"example.com/v.Version": "1.2.3",
+	}, map[string]bool{"main.Other": true}, map[string]bool{"example.com/v": true}, nil)
+	require.Nil(t, err)
+
+	// the variables of optional packages that exist are checked
+	_, err = verifyBinary(bin, map[string]string{
+		"main.Version":    "1.2.3",
+		"main.GitSummary": "v1.2.3",
+	}, nil, map[string]bool{"main": true}, nil)
+	require.Nil(t, err)
+	_, err = verifyBinary(bin, map[string]string{"main.Version": "1.0"}, nil, map[string]bool{"main": true}, nil)
+	require.NotNil(t, err)
+}
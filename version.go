@@ -1,6 +1,10 @@
 package main
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/ahmetb/govvv/version"
+)
 
 var (
 	// Version is populated at compile time by govvv from ./VERSION
@@ -14,8 +18,14 @@ var (
 )
 
 func versionString() string {
-	if Version == "" {
+	v, commit, state := Version, GitCommit, GitState
+	if v == "" {
+		// not built with govvv, use what the go tool recorded
+		i := version.Get()
+		v, commit, state = i.Version, i.GitCommit, i.GitState
+	}
+	if v == "" {
 		return "N/A"
 	}
-	return fmt.Sprintf("%s@%s-%s", Version, GitCommit, GitState)
+	return fmt.Sprintf("%s@%s-%s", v, commit, state)
 }
@@ -0,0 +1,109 @@
+package version
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Handler returns an http.Handler that serves the build information, as JSON
+// by default, or as the text of Info.String if the "format" query parameter
+// is "text" or the request accepts text/plain but not JSON.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		i := Get()
+		if wantsText(r) {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			fmt.Fprintln(w, i.String())
+			return
+		}
+		b, err := json.Marshal(i)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(append(b, '\n'))
+	})
+}
+
+// wantsText reports whether the build information should be served as text.
+func wantsText(r *http.Request) bool {
+	switch r.URL.Query().Get("format") {
+	case "text":
+		return true
+	case "json":
+		return false
+	}
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "text/plain") && !strings.Contains(accept, "application/json")
+}
+
+// Publish publishes the build information as an expvar variable with the given
+// name, which shows up as a JSON object at /debug/vars. Like expvar.Publish,
+// it panics if the name is already in use.
+func Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} { return Get() }))
+}
+
+// defaultMetricName is the name of the build information metric if no name
+// is given.
+const defaultMetricName = "build_info"
+
+// WritePrometheus writes the build information as a gauge metric with the
+// given name (default "build_info") in the Prometheus text exposition format:
+//
+//	build_info{version="1.0.0",commit="0b5ed7a",branch="master",state="clean",goversion="go1.21.0"} 1
+//
+// It can be appended to the output of an existing metrics endpoint.
+func WritePrometheus(w io.Writer, name string) error {
+	if name == "" {
+		name = defaultMetricName
+	}
+	i := Get()
+	labels := []struct{ name, value string }{
+		{"version", i.Version},
+		{"commit", i.GitCommit},
+		{"branch", i.GitBranch},
+		{"state", i.GitState},
+		{"goversion", i.GoVersion},
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "# HELP %s Build information of the program, the value is always 1.\n", name)
+	fmt.Fprintf(&b, "# TYPE %s gauge\n", name)
+	b.WriteString(name)
+	for n, l := range labels {
+		if n == 0 {
+			b.WriteByte('{')
+		} else {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", l.name, escapeLabelValue(l.value))
+	}
+	b.WriteString("} 1\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// escapeLabelValue escapes a label value for the Prometheus text format.
+func escapeLabelValue(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+// PrometheusHandler returns an http.Handler that serves the build information
+// metric written by WritePrometheus, e.g. for a /metrics endpoint of a program
+// that has no other metrics.
+func PrometheusHandler(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WritePrometheus(w, name)
+	})
+}
@@ -0,0 +1,79 @@
+package version
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func setTestVars(t *testing.T) {
+	setVars(t, map[*string]string{
+		&Version:    "1.0.0",
+		&GitCommit:  "0b5ed7a",
+		&GitBranch:  `feature/"x"`,
+		&GitState:   "clean",
+		&GitSummary: "v1.0.0",
+		&BuildDate:  "",
+		&BuildUnix:  "1500000000",
+		&CommitDate: "",
+		&ChangeID:   "",
+	}, nil)
+}
+
+func TestHandler(t *testing.T) {
+	setTestVars(t)
+	cases := []struct {
+		target, accept, contentType, body string
+	}{
+		{"/version", "", "application/json", `"version":"1.0.0"`},
+		{"/version", "text/plain", "text/plain; charset=utf-8",
+			"1.0.0 (commit 0b5ed7a, branch feature/\"x\", built 2017-07-14T02:40:00Z)\n"},
+		{"/version", "text/plain, application/json", "application/json", `"gitCommit":"0b5ed7a"`},
+		{"/version?format=text", "", "text/plain; charset=utf-8", "1.0.0 (commit"},
+		{"/version?format=json", "text/plain", "application/json", `"buildDate":"2017-07-14T02:40:00Z"`},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", c.target, nil)
+		if c.accept != "" {
+			r.Header.Set("Accept", c.accept)
+		}
+		w := httptest.NewRecorder()
+		Handler().ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, c.contentType, w.Header().Get("Content-Type"), "target=%s accept=%s", c.target, c.accept)
+		require.Contains(t, w.Body.String(), c.body, "target=%s accept=%s", c.target, c.accept)
+	}
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("POST", "/version", nil))
+	require.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestPublish(t *testing.T) {
+	setTestVars(t)
+	Publish("govvv_test_build")
+	var i map[string]interface{}
+	require.Nil(t, json.Unmarshal([]byte(expvar.Get("govvv_test_build").String()), &i))
+	require.Equal(t, "1.0.0", i["version"])
+}
+
+func TestWritePrometheus(t *testing.T) {
+	setTestVars(t)
+	var b strings.Builder
+	require.Nil(t, WritePrometheus(&b, ""))
+	require.Equal(t, "# HELP build_info Build information of the program, the value is always 1.\n"+
+		"# TYPE build_info gauge\n"+
+		`build_info{version="1.0.0",commit="0b5ed7a",branch="feature/\"x\"",state="clean",goversion="`+runtime.Version()+`"} 1`+"\n",
+		b.String())
+
+	w := httptest.NewRecorder()
+	PrometheusHandler("myapp_build_info").ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, "text/plain; version=0.0.4; charset=utf-8", w.Header().Get("Content-Type"))
+	require.Contains(t, w.Body.String(), "\nmyapp_build_info{version=\"1.0.0\",")
+}
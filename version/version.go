@@ -0,0 +1,245 @@
+// Package version exposes the build information govvv sets at compile time.
+// Values govvv did not set are read from the build information the go tool
+// embeds in binaries, if possible.
+//
+// govvv sets the variables of this package automatically when the program
+// being built imports it:
+//
+//	import "github.com/ahmetb/govvv/version"
+//
+//	fmt.Println(version.Get())
+package version
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// These variables are populated at compile time by govvv.
+var (
+	// Version is read from the VERSION file or the -version directive.
+	Version string
+
+	// GitCommit is the short hash of the commit the program is built from.
+	GitCommit string
+
+	// GitBranch is the branch the program is built from.
+	GitBranch string
+
+	// GitState is "clean" or "dirty".
+	GitState string
+
+	// GitSummary is the output of "git describe --tags --dirty --always".
+	GitSummary string
+
+	// BuildDate is the time of the build, in RFC3339 format unless
+	// -date-format is given.
+	BuildDate string
+
+	// BuildUnix is the time of the build as a unix timestamp.
+	BuildUnix string
+
+	// CommitDate is the time of the commit, in the format of BuildDate.
+	CommitDate string
+
+	// ChangeID is the ID of the change the program is built from, with
+	// version control systems that have one (jj).
+	ChangeID string
+)
+
+// Source is where a value in Info comes from.
+type Source string
+
+// sources of the values in Info
+const (
+	// SourceGovvv is for values set by govvv at compile time.
+	SourceGovvv Source = "govvv"
+
+	// SourceBuildInfo is for values read from the build information the go
+	// tool embeds in binaries (see runtime/debug.ReadBuildInfo), which are
+	// used when the program is not built with govvv.
+	SourceBuildInfo Source = "buildinfo"
+)
+
+// Info is the build information of the program.
+type Info struct {
+	Version    string
+	GitCommit  string
+	GitBranch  string
+	GitState   string
+	GitSummary string
+	BuildDate  time.Time // zero if unknown
+	CommitDate time.Time // zero if unknown
+	ChangeID   string
+	GoVersion  string
+
+	// Sources maps the names of the fields above that are known, except
+	// GoVersion, to where their values come from.
+	Sources map[string]Source
+}
+
+// readBuildInfo is debug.ReadBuildInfo, replaced in tests.
+var readBuildInfo = debug.ReadBuildInfo
+
+// Get returns the build information of the program. The values govvv did not
+// set are filled from the build information embedded by the go tool, if
+// possible: the main module version, and the revision, time and state of the
+// commit if the go tool stamped it with version control information.
+func Get() Info {
+	i := Info{
+		Version:    Version,
+		GitCommit:  GitCommit,
+		GitBranch:  GitBranch,
+		GitState:   GitState,
+		GitSummary: GitSummary,
+		BuildDate:  parseTime(BuildUnix, BuildDate),
+		CommitDate: parseTime("", CommitDate),
+		ChangeID:   ChangeID,
+		GoVersion:  runtime.Version(),
+		Sources:    make(map[string]Source),
+	}
+	for name, known := range map[string]bool{
+		"Version":    i.Version != "",
+		"GitCommit":  i.GitCommit != "",
+		"GitBranch":  i.GitBranch != "",
+		"GitState":   i.GitState != "",
+		"GitSummary": i.GitSummary != "",
+		"BuildDate":  !i.BuildDate.IsZero(),
+		"CommitDate": !i.CommitDate.IsZero(),
+		"ChangeID":   i.ChangeID != "",
+	} {
+		if known {
+			i.Sources[name] = SourceGovvv
+		}
+	}
+	if bi, ok := readBuildInfo(); ok {
+		i.fillFromBuildInfo(bi)
+	}
+	return i
+}
+
+// fillFromBuildInfo sets the unknown values that the go tool recorded in bi.
+func (i *Info) fillFromBuildInfo(bi *debug.BuildInfo) {
+	settings := make(map[string]string)
+	for _, s := range bi.Settings {
+		settings[s.Key] = s.Value
+	}
+	fill := func(name string, field *string, v string) {
+		if *field == "" && v != "" {
+			*field = v
+			i.Sources[name] = SourceBuildInfo
+		}
+	}
+
+	if v := bi.Main.Version; v != "(devel)" {
+		fill("Version", &i.Version, v)
+	}
+	revision := settings["vcs.revision"]
+	if len(revision) > shortRevisionLen {
+		revision = revision[:shortRevisionLen]
+	}
+	fill("GitCommit", &i.GitCommit, revision)
+	switch settings["vcs.modified"] {
+	case "true":
+		fill("GitState", &i.GitState, "dirty")
+	case "false":
+		fill("GitState", &i.GitState, "clean")
+	}
+	if t, err := time.Parse(time.RFC3339, settings["vcs.time"]); err == nil && i.CommitDate.IsZero() {
+		i.CommitDate = t
+		i.Sources["CommitDate"] = SourceBuildInfo
+	}
+}
+
+// shortRevisionLen is the length GitCommit is shortened to when it is read
+// from the build information, which has the full revision.
+const shortRevisionLen = 7
+
+// parseTime parses a unix timestamp, or an RFC3339 date if unix is empty. It
+// returns the zero time if neither can be parsed.
+func parseTime(unix, date string) time.Time {
+	if n, err := strconv.ParseInt(unix, 10, 64); err == nil {
+		return time.Unix(n, 0).UTC()
+	}
+	if t, err := time.Parse(time.RFC3339Nano, date); err == nil {
+		return t
+	}
+	return time.Time{}
+}
+
+// Dirty reports whether the program was built from a working copy with
+// uncommitted changes.
+func (i Info) Dirty() bool {
+	return i.GitState == "dirty"
+}
+
+// String returns a one-line description of the build, e.g.
+// "1.0.0 (commit 0b5ed7a, branch master, dirty, built 2017-07-14T02:40:00Z)".
+func (i Info) String() string {
+	version := i.Version
+	if version == "" {
+		version = "(devel)"
+	}
+	var details []string
+	if i.GitCommit != "" {
+		details = append(details, "commit "+i.GitCommit)
+	}
+	if i.GitBranch != "" {
+		details = append(details, "branch "+i.GitBranch)
+	}
+	if i.Dirty() {
+		details = append(details, "dirty")
+	}
+	if !i.BuildDate.IsZero() {
+		details = append(details, "built "+i.BuildDate.Format(time.RFC3339))
+	}
+	if len(details) == 0 {
+		return version
+	}
+	return fmt.Sprintf("%s (%s)", version, strings.Join(details, ", "))
+}
+
+// infoJSON is the JSON representation of Info.
+type infoJSON struct {
+	Version    string `json:"version,omitempty"`
+	GitCommit  string `json:"gitCommit,omitempty"`
+	GitBranch  string `json:"gitBranch,omitempty"`
+	GitState   string `json:"gitState,omitempty"`
+	GitSummary string `json:"gitSummary,omitempty"`
+	BuildDate  string `json:"buildDate,omitempty"`
+	CommitDate string `json:"commitDate,omitempty"`
+	ChangeID   string `json:"changeID,omitempty"`
+	GoVersion  string `json:"goVersion,omitempty"`
+
+	Sources map[string]Source `json:"sources,omitempty"`
+}
+
+// MarshalJSON encodes the build information as a JSON object with the dates
+// in RFC3339 format, leaving out unknown values.
+func (i Info) MarshalJSON() ([]byte, error) {
+	return json.Marshal(infoJSON{
+		Version:    i.Version,
+		GitCommit:  i.GitCommit,
+		GitBranch:  i.GitBranch,
+		GitState:   i.GitState,
+		GitSummary: i.GitSummary,
+		BuildDate:  formatTime(i.BuildDate),
+		CommitDate: formatTime(i.CommitDate),
+		ChangeID:   i.ChangeID,
+		GoVersion:  i.GoVersion,
+		Sources:    i.Sources,
+	})
+}
+
+// formatTime formats t in RFC3339 format, or returns "" for the zero time.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
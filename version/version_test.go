@@ -0,0 +1,129 @@
+package version
+
+import (
+	"encoding/json"
+	"runtime"
+	"runtime/debug"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// setVars sets the variables and the build information for the duration of
+// the test.
+func setVars(t *testing.T, vars map[*string]string, bi *debug.BuildInfo) {
+	old := make(map[*string]string)
+	for p, v := range vars {
+		old[p] = *p
+		*p = v
+	}
+	oldReadBuildInfo := readBuildInfo
+	readBuildInfo = func() (*debug.BuildInfo, bool) { return bi, bi != nil }
+	t.Cleanup(func() {
+		for p, v := range old {
+			*p = v
+		}
+		readBuildInfo = oldReadBuildInfo
+	})
+}
+
+func TestGet(t *testing.T) {
+	setVars(t, map[*string]string{
+		&Version:    "1.0.0",
+		&GitCommit:  "0b5ed7a",
+		&GitBranch:  "master",
+		&GitState:   "dirty",
+		&GitSummary: "v1.0.0-dirty",
+		&BuildDate:  "14 Jul 17",
+		&BuildUnix:  "1500000000",
+		&CommitDate: "2017-07-13T10:00:00+02:00",
+	}, nil)
+	i := Get()
+	require.Equal(t, "1.0.0", i.Version)
+	require.True(t, i.Dirty())
+	require.Equal(t, time.Unix(1500000000, 0).UTC(), i.BuildDate)
+	require.True(t, i.CommitDate.Equal(time.Date(2017, 7, 13, 8, 0, 0, 0, time.UTC)))
+	require.Equal(t, runtime.Version(), i.GoVersion)
+	require.Equal(t, "1.0.0 (commit 0b5ed7a, branch master, dirty, built 2017-07-14T02:40:00Z)", i.String())
+	require.Equal(t, map[string]Source{
+		"Version":    SourceGovvv,
+		"GitCommit":  SourceGovvv,
+		"GitBranch":  SourceGovvv,
+		"GitState":   SourceGovvv,
+		"GitSummary": SourceGovvv,
+		"BuildDate":  SourceGovvv,
+		"CommitDate": SourceGovvv,
+	}, i.Sources)
+}
+
+func TestGet_buildInfo(t *testing.T) {
+	bi := &debug.BuildInfo{
+		Main: debug.Module{Path: "example.com/app", Version: "v1.2.3"},
+		Settings: []debug.BuildSetting{
+			{Key: "vcs", Value: "git"},
+			{Key: "vcs.revision", Value: "0b5ed7a3c0ffee0b5ed7a3c0ffee0b5ed7a3c0ff"},
+			{Key: "vcs.time", Value: "2017-07-13T08:00:00Z"},
+			{Key: "vcs.modified", Value: "false"},
+		},
+	}
+	setVars(t, map[*string]string{
+		&Version: "", &GitCommit: "", &GitBranch: "", &GitState: "", &GitSummary: "",
+		&BuildDate: "", &BuildUnix: "", &CommitDate: "", &ChangeID: "",
+	}, bi)
+	i := Get()
+	require.Equal(t, "v1.2.3", i.Version)
+	require.Equal(t, "0b5ed7a", i.GitCommit)
+	require.Equal(t, "clean", i.GitState)
+	require.Equal(t, time.Date(2017, 7, 13, 8, 0, 0, 0, time.UTC), i.CommitDate)
+	require.True(t, i.BuildDate.IsZero())
+	require.Equal(t, map[string]Source{
+		"Version":    SourceBuildInfo,
+		"GitCommit":  SourceBuildInfo,
+		"GitState":   SourceBuildInfo,
+		"CommitDate": SourceBuildInfo,
+	}, i.Sources)
+
+	// values set by govvv are kept
+	setVars(t, map[*string]string{&Version: "1.0", &GitState: "dirty"}, bi)
+	bi.Main.Version = "(devel)"
+	bi.Settings[3].Value = "true"
+	i = Get()
+	require.Equal(t, "1.0", i.Version)
+	require.Equal(t, "dirty", i.GitState)
+	require.Equal(t, SourceGovvv, i.Sources["Version"])
+	require.Equal(t, SourceGovvv, i.Sources["GitState"])
+
+	// a devel version is not used
+	setVars(t, map[*string]string{&Version: ""}, bi)
+	i = Get()
+	require.Equal(t, "", i.Version)
+	require.Equal(t, "(devel) (commit 0b5ed7a, branch x)", Info{GitCommit: "0b5ed7a", GitBranch: "x"}.String())
+}
+
+func TestGet_unset(t *testing.T) {
+	setVars(t, map[*string]string{&BuildUnix: "", &BuildDate: "2017-07-14T02:40:00Z", &CommitDate: "unknown"}, nil)
+	i := Get()
+	require.Equal(t, time.Date(2017, 7, 14, 2, 40, 0, 0, time.UTC), i.BuildDate)
+	require.True(t, i.CommitDate.IsZero())
+
+	require.Equal(t, "(devel)", Info{}.String())
+	require.Equal(t, "1.0 (branch x)", Info{Version: "1.0", GitBranch: "x"}.String())
+}
+
+func TestInfo_MarshalJSON(t *testing.T) {
+	b, err := json.Marshal(Info{
+		Version:   "1.0.0",
+		GitCommit: "0b5ed7a",
+		BuildDate: time.Unix(1500000000, 0).UTC(),
+		GoVersion: "go1.21.0",
+		Sources:   map[string]Source{"Version": SourceGovvv, "GitCommit": SourceBuildInfo},
+	})
+	require.Nil(t, err)
+	require.Equal(t, `{"version":"1.0.0","gitCommit":"0b5ed7a","buildDate":"2017-07-14T02:40:00Z","goVersion":"go1.21.0",`+
+		`"sources":{"GitCommit":"buildinfo","Version":"govvv"}}`, string(b))
+
+	b, err = json.Marshal(Info{})
+	require.Nil(t, err)
+	require.Equal(t, `{}`, string(b))
+}